@@ -4,17 +4,28 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 
+	"github.com/ande980/config/crypt"
 	"github.com/ande980/config/env"
 	"github.com/ande980/config/flags"
-	"github.com/ande980/config/json"
-	"github.com/ande980/config/toml"
-	"github.com/ande980/config/yaml"
-	multierror "github.com/hashicorp/go-multierror"
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/internal/format"
+	"github.com/ande980/config/naming"
+	"github.com/ande980/config/secret"
+
+	// The built-in formats register themselves with the format
+	// package, as hcl does when it's imported.
+	_ "github.com/ande980/config/ini"
+	_ "github.com/ande980/config/json"
+	_ "github.com/ande980/config/properties"
+	_ "github.com/ande980/config/toml"
+	_ "github.com/ande980/config/yaml"
 )
 
 var (
@@ -22,8 +33,68 @@ var (
 	ErrHelp = errors.New("help requested")
 	// ErrVersion is returned when the -v or --version flags are used.
 	ErrVersion = errors.New("version requested")
+	// ErrGenerateConfig is returned when the --generate-config flag
+	// is used, once an example configuration file in the format
+	// given by the flag has been written to standard output.
+	ErrGenerateConfig = errors.New("example configuration requested")
+	// ErrComplete is returned when a shell completion script runs
+	// the program to complete a value. See flags.FlagSet.Completion.
+	ErrComplete = errors.New("completion requested")
 )
 
+// FileError is returned by the json, toml and yaml providers when
+// a file can't be decoded. It carries the path, format, line,
+// column and key of the problem where they could be determined
+// and can be retrieved with errors.As.
+type FileError = errs.FileError
+
+// FieldError is returned by every provider when a value can't be
+// stored in a field. It names the field, the provider, the key
+// the value was found under and the value itself.
+type FieldError = errs.FieldError
+
+// RuleError is returned by Parse, given ValidateRules, for every
+// value that breaks a validation rule given in its struct tags, such
+// as max:"65535" or validate:"url". It names the field and the rule.
+type RuleError = errs.RuleError
+
+// SchemaError is returned by Parse for every value that doesn't
+// match the JSON Schema given to ValidateSchema. It names the value
+// by its JSON pointer and locates it in the configuration file it
+// came from where it can.
+type SchemaError = errs.SchemaError
+
+// Errors is returned by Parse when one or more providers failed.
+// errors.As and errors.Is look through every error in the list.
+type Errors = errs.Errors
+
+// SecretResolver turns a value referring to a secret, such as
+// file:///run/secrets/db_password, into the secret itself. See
+// the secret package.
+type SecretResolver = secret.Resolver
+
+// Decrypter decrypts ENC[...] values. See the crypt package.
+type Decrypter = crypt.Decrypter
+
+// stdin is read when the configuration path is -, and stdout
+// written to by --generate-config.
+var (
+	stdin  io.Reader = os.Stdin
+	stdout io.Writer = os.Stdout
+)
+
+// NamingStrategy converts field names into the names a source
+// uses for them. See the naming package.
+type NamingStrategy = naming.Strategy
+
+// Naming holds a NamingStrategy for each kind of source. A nil
+// strategy leaves the source's default naming alone.
+type Naming struct {
+	Env  NamingStrategy
+	Flag NamingStrategy
+	File NamingStrategy
+}
+
 // Yay for global state. Why are you parsing more than one configuration file?
 var providers = []Provider{
 	env.New(),
@@ -59,10 +130,244 @@ type Provider interface {
 	Parse(interface{}) error
 }
 
+// Option configures optional behaviour of Parse.
+type Option func(*options)
+
+type options struct {
+	expand    bool
+	strict    bool
+	refs      bool
+	resolver  secret.Resolver
+	decrypter crypt.Decrypter
+	format    string
+	naming    Naming
+	flags     *flags.FlagSet
+	rules     bool
+	validate  bool
+	schemaBuf []byte
+	schemaAt  string
+	promptIn  io.Reader
+	promptOut io.Writer
+}
+
+// ExpandEnv enables ${NAME} and ${NAME:-default} environmental
+// variable placeholders in configuration files. If strict is
+// true an unset variable without a default is an error.
+func ExpandEnv(strict bool) Option {
+	return func(o *options) {
+		o.expand = true
+		o.strict = strict
+	}
+}
+
+// References enables ${server.host} style references from string
+// values to other values by their path, resolved once every
+// provider has run. $${ is a literal ${. Without it strings are
+// left as they are.
+func References() Option {
+	return func(o *options) {
+		o.refs = true
+	}
+}
+
+// WithSecretResolver enables secret references, passing every string
+// value read from the environment, flags and configuration files
+// through r as it's read. secret.Default() understands file://
+// references, and secret.Schemes adds others. Without it values are
+// left as they are.
+func WithSecretResolver(r SecretResolver) Option {
+	return func(o *options) {
+		o.resolver = r
+	}
+}
+
+// WithDecrypter enables decryption of ENC[...] values, both in
+// configuration files and in values from other providers. See
+// the crypt package.
+func WithDecrypter(d Decrypter) Option {
+	return func(o *options) {
+		o.decrypter = d
+	}
+}
+
+// Format sets the format of configuration read from standard input
+// with --config - and by FromReader and FromBytes, one of json,
+// jsonc, toml, yaml, ini or properties, or hcl if the hcl package
+// is imported. By default the format is detected from the content.
+func Format(format string) Option {
+	return func(o *options) {
+		o.format = format
+	}
+}
+
+// WithNaming sets the naming strategy of each kind of source, so
+// that ProxyAddr can be APP_PROXY_ADDR, --proxy-addr and proxy_addr:
+//
+//	config.WithNaming(config.Naming{
+//		Env:  naming.ScreamingSnake,
+//		Flag: naming.Kebab,
+//		File: naming.Snake,
+//	})
+func WithNaming(n Naming) Option {
+	return func(o *options) {
+		o.naming = n
+	}
+}
+
+// WithFlags makes Parse read flags with fs in place of its own
+// FlagSet, so that the completers and commands added to fs for
+// its completion scripts are the ones Parse answers __complete
+// with:
+//
+//	fs := flags.New().WithCompleter("region", regions)
+//	err := config.Parse(cfg, config.WithFlags(fs))
+func WithFlags(fs *flags.FlagSet) Option {
+	return func(o *options) {
+		o.flags = fs
+	}
+}
+
+// ValidateRules enables the validation rules given in struct tags,
+// such as max:"65535" or validate:"url", which are checked once
+// every provider has run. See RuleError. Entries in validate tags
+// that aren't rules, such as those of other validation packages,
+// are ignored.
+func ValidateRules() Option {
+	return func(o *options) {
+		o.rules = true
+	}
+}
+
+// ValidateSchema validates the merged configuration against a JSON
+// Schema once every provider has run. If schema is nil the schema
+// generated from the struct by Schema is used, less the validation
+// tags if ValidateRules is given too, as they're checked as rules
+// then and a value shouldn't be reported twice. See SchemaError.
+func ValidateSchema(schema []byte) Option {
+	return func(o *options) {
+		o.validate = true
+		o.schemaBuf = schema
+	}
+}
+
+// ValidateSchemaFile is ValidateSchema with the schema read from
+// the file at path.
+func ValidateSchemaFile(path string) Option {
+	return func(o *options) {
+		o.validate = true
+		o.schemaAt = path
+	}
+}
+
+// file returns a provider for the configuration file at path
+// chosen by its extension, or nil if the extension is unknown or
+// belongs to a format, such as hcl, whose package isn't imported.
+func (o *options) file(path string) Provider {
+	if fn := format.Lookup(strings.TrimPrefix(filepath.Ext(path), ".")); fn != nil {
+		return fn(nil, path, o.fileOptions())
+	}
+	return nil
+}
+
+// fileOptions returns the options that apply to file providers.
+func (o *options) fileOptions() format.Options {
+	return format.Options{
+		Expand:    o.expand,
+		Strict:    o.strict,
+		Resolver:  o.resolver,
+		Decrypter: o.decrypter,
+		Naming:    o.naming.File,
+	}
+}
+
+// sources returns the providers Parse starts with. The env and
+// flags providers are copied before the naming strategies and the
+// resolver are applied, so the package's own are left as they are
+// for later calls. The FlagSet given to WithFlags takes the place of
+// the flags provider.
+func (o *options) sources() []Provider {
+	list := make([]Provider, 0, len(providers)+1)
+	replaced := false
+	for _, provider := range providers {
+		switch p := provider.(type) {
+		case *env.Provider:
+			cp := *p
+			if o.naming.Env != nil {
+				cp.WithNaming(o.naming.Env)
+			}
+			if o.resolver != nil {
+				cp.WithResolver(o.resolver)
+			}
+			provider = &cp
+		case *flags.FlagSet:
+			if o.flags != nil {
+				p, replaced = o.flags, true
+			}
+			provider = o.flagSet(p)
+		}
+		list = append(list, provider)
+	}
+	if o.flags != nil && !replaced {
+		list = append(list, o.flagSet(o.flags))
+	}
+	return list
+}
+
+// flagSet returns a copy of fs given the flag naming strategy and
+// the resolver.
+func (o *options) flagSet(fs *flags.FlagSet) *flags.FlagSet {
+	cp := *fs
+	if o.naming.Flag != nil {
+		cp.WithNaming(o.naming.Flag)
+	}
+	if o.resolver != nil {
+		cp.WithResolver(o.resolver)
+	}
+	return &cp
+}
+
+// defaults returns providers for the configuration files named
+// after the binary, as created by json.New, toml.New and yaml.New.
+func (o *options) defaults() []Provider {
+	var list []Provider
+	for _, path := range defaultPaths() {
+		list = append(list, o.file(path))
+	}
+	return list
+}
+
+func defaultPaths() []string {
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), filepath.Ext(os.Args[0]))
+	return []string{name + ".json", name + ".toml", name + ".yaml"}
+}
+
+// flagValue returns the value of the flag called name in args,
+// given as -name value, --name value, -name=value or --name=value.
+// The --config and --generate-config flags are handled here rather
+// than by the flags provider as they decide what Parse does.
+func flagValue(args []string, name string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		flag := strings.TrimPrefix(arg[1:], "-")
+		if flag == name && i+1 < len(args) {
+			return args[i+1], true
+		}
+		if strings.HasPrefix(flag, name+"=") {
+			return strings.TrimPrefix(flag, name+"="), true
+		}
+	}
+	return "", false
+}
+
 // Parse acccepts a variadic number of config providers and returns an error.
 // If a single provider returns an error then it will be return even if
 // all other providers functioned correctly.
-func Parse(i interface{}) (err error) {
+func Parse(i interface{}, opts ...Option) (err error) {
 	defer func() {
 		if p := recover(); p != nil {
 			switch t := p.(type) {
@@ -74,27 +379,47 @@ func Parse(i interface{}) (err error) {
 		}
 	}()
 
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	// This is highly opinionated but it does what I need it to.
-	fs := flag.NewFlagSet("", flag.ContinueOnError)
-	fs.Usage = func() {}
-	fs.SetOutput(ioutil.Discard)
-	fs.Parse(os.Args[1:])
-	if len(fs.Args()) > 0 {
-		configPath := fs.Args()[0]
-		if _, err := os.Stat(configPath); err == nil {
-			switch filepath.Ext(configPath) {
-			case ".json":
-				providers = append(providers, json.WithPath(configPath))
-			case ".toml":
-				providers = append(providers, toml.WithPath(configPath))
-			case ".yaml", ".yml":
-				providers = append(providers, yaml.WithPath(configPath))
-			}
-		} else {
-			providers = append(providers, json.New(), toml.New(), yaml.New())
+	configPath, ok := flagValue(os.Args[1:], "config")
+	if !ok {
+		fs := flag.NewFlagSet("", flag.ContinueOnError)
+		fs.Usage = func() {}
+		fs.SetOutput(ioutil.Discard)
+		fs.Parse(os.Args[1:])
+		if len(fs.Args()) > 0 {
+			configPath = fs.Args()[0]
+		}
+	}
+
+	list := o.sources()
+	// A file named with --config has to be there, while the first
+	// argument may not be a file at all.
+	var files []string
+	_, statErr := os.Stat(configPath)
+	switch {
+	case configPath == "-":
+		list = append(list, o.sniff(stdin))
+	case ok && statErr != nil:
+		err = fmt.Errorf("reading configuration file: %v", statErr)
+		return err
+	case configPath != "" && statErr == nil:
+		p := o.file(configPath)
+		if p == nil && ok {
+			err = fmt.Errorf("unsupported configuration file %s", configPath)
+			return err
+		}
+		if p != nil {
+			list = append(list, p)
+			files = append(files, configPath)
 		}
-	} else {
-		providers = append(providers, json.New(), toml.New(), yaml.New())
+	default:
+		list = append(list, o.defaults()...)
+		files = append(files, defaultPaths()...)
 	}
 
 	v := reflect.ValueOf(i)
@@ -109,7 +434,7 @@ func Parse(i interface{}) (err error) {
 		return err
 	}
 
-	if len(providers) == 0 {
+	if len(list) == 0 {
 		err = fmt.Errorf("no providers specified")
 		return err
 	}
@@ -120,24 +445,46 @@ func Parse(i interface{}) (err error) {
 		}
 	}
 
-	var result *multierror.Error
-	for _, provider := range providers {
+	if format, ok := flagValue(os.Args[1:], "generate-config"); ok {
+		if err = GenerateExample(stdout, i, format, opts...); err != nil {
+			return err
+		}
+		return ErrGenerateConfig
+	}
+
+	var result Errors
+	for _, provider := range list {
 		if err = provider.Parse(i); err != nil {
 			switch err {
 			case flags.ErrHelp:
 				return ErrHelp
 			case flags.ErrVersion:
 				return ErrVersion
+			case flags.ErrComplete:
+				return ErrComplete
 			default:
-				result = multierror.Append(result, err)
+				result = result.Append(err)
 			}
 		}
 	}
+	if o.promptIn != nil {
+		result = result.Append(prompt(v, o.promptIn, o.promptOut))
+	}
+	if o.decrypter != nil {
+		result = result.Append(crypt.Struct(i, o.decrypter))
+	}
+	if o.refs {
+		result = result.Append(resolveReferences(v))
+	}
+	if o.rules {
+		result = result.Append(validateRules(v))
+	}
+	if o.validate {
+		result = result.Append(o.validateSchema(v, files))
+	}
 
 	if validator, ok := i.(Validator); ok {
-		if err = validator.Validate(); err != nil {
-			return err
-		}
+		result = result.Append(validator.Validate())
 	}
 
 	err = result.ErrorOrNil()
@@ -1,13 +1,27 @@
 package config
 
 import (
+	"bytes"
+	stdjson "encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/ande980/config/env"
+	"github.com/ande980/config/flags"
+	_ "github.com/ande980/config/hcl"
 	"github.com/ande980/config/json"
+	"github.com/ande980/config/naming"
+	"github.com/ande980/config/secret"
+	"github.com/ande980/config/toml"
+	"github.com/ande980/config/yaml"
 )
 
 type Config struct {
@@ -64,3 +78,939 @@ func TestConfig(t *testing.T) {
 		t.Errorf("expected '%s', got '%s'", ":9091", cfg.Server.Addr)
 	}
 }
+
+func TestErrors(t *testing.T) {
+	cfg := &Config{Server: &Server{}}
+
+	os.Setenv("ERRORS_C", "forever")
+	defer os.Unsetenv("ERRORS_C")
+
+	providers = []Provider{
+		json.WithReader(strings.NewReader(`{"Server":{"Addr":9090}}`)),
+		env.WithPrefix("errors"),
+	}
+
+	err := Parse(cfg)
+	list, ok := err.(Errors)
+	if !ok || len(list) != 2 {
+		t.Fatalf("expected 2 errors, got '%v'", err)
+	}
+
+	var fileErr *FileError
+	if !errors.As(err, &fileErr) || fileErr.Key != "Server.Addr" {
+		t.Errorf("expected a FileError for Server.Addr, got %v", fileErr)
+	}
+
+	var fieldErr *FieldError
+	if !errors.As(list[1], &fieldErr) || fieldErr.Path != "C" || fieldErr.Source != "env" {
+		t.Errorf("expected an env FieldError for C, got %v", fieldErr)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.json")
+	if err := ioutil.WriteFile(path, []byte(`{"Server":{"Addr":"${EXPAND_HOST}:${EXPAND_PORT:-8080}"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("EXPAND_HOST", "localhost")
+	defer os.Unsetenv("EXPAND_HOST")
+
+	args := os.Args
+	os.Args = []string{"app", path}
+	defer func() { os.Args = args }()
+
+	providers = []Provider{}
+
+	cfg := &Config{Server: &Server{}}
+	if err := Parse(cfg, ExpandEnv(true)); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if cfg.Server.Addr != "localhost:8080" {
+		t.Errorf("expected '%s', got '%s'", "localhost:8080", cfg.Server.Addr)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	type Server struct {
+		Host string `yaml:"hostname"`
+		Port int
+	}
+	type Config struct {
+		Server    Server
+		PublicURL string `json:"public_url"`
+		Admin     string
+		Literal   string
+		Env       string
+	}
+
+	cfg := &Config{
+		Server:    Server{Host: "example.com", Port: 8443},
+		PublicURL: "https://${server.hostname}:${server.port}",
+		Admin:     "${public_url}/admin",
+		Literal:   "$${server.port}",
+		Env:       "${HOME}",
+	}
+
+	providers = []Provider{}
+	if err := Parse(cfg); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if cfg.PublicURL != "https://${server.hostname}:${server.port}" || cfg.Literal != "$${server.port}" {
+		t.Errorf("expected strings to be left alone without References, got '%s' and '%s'", cfg.PublicURL, cfg.Literal)
+	}
+
+	if err := Parse(cfg, References()); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	expected := []string{"https://example.com:8443", "https://example.com:8443/admin", "${server.port}", "${HOME}"}
+	for i, got := range []string{cfg.PublicURL, cfg.Admin, cfg.Literal, cfg.Env} {
+		if got != expected[i] {
+			t.Errorf("expected '%s', got '%s'", expected[i], got)
+		}
+	}
+
+	cfg = &Config{
+		Server:    Server{Host: "${admin}"},
+		PublicURL: "https://${server.host}",
+		Admin:     "${public_url}/admin",
+		Literal:   "${server.missing}",
+	}
+
+	err := Parse(cfg, References())
+	list, ok := err.(Errors)
+	if !ok || len(list) != 2 {
+		t.Fatalf("expected 2 errors, got '%v'", err)
+	}
+
+	if msg := "reference cycle: Server.Host -> Admin -> PublicURL -> Server.Host"; !strings.Contains(list[0].Error(), msg) {
+		t.Errorf("expected '%s', got '%s'", msg, list[0])
+	}
+
+	if msg := "Literal: reference server.missing"; !strings.HasPrefix(list[1].Error(), msg) {
+		t.Errorf("expected '%s', got '%s'", msg, list[1])
+	}
+}
+
+func TestSecretResolver(t *testing.T) {
+	var resolved []string
+	stub := secret.ResolverFunc(func(value string) (string, error) {
+		if !strings.HasPrefix(value, "stub://") {
+			return value, nil
+		}
+		resolved = append(resolved, value)
+		return "hunter2", nil
+	})
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.json")
+	if err := ioutil.WriteFile(path, []byte(`{"abcd":"stub://a"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"app", path}
+
+	// Values aren't resolved unless asked.
+	providers = []Provider{env.WithPrefix("secrets").WithVars(map[string]string{"SECRETS_SERVER_ADDR": "stub://addr"})}
+	cfg := &Config{Server: &Server{}}
+	if err := Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.A != "stub://a" || cfg.Server.Addr != "stub://addr" || len(resolved) != 0 {
+		t.Errorf("expected values to be left alone, got '%s' and '%s'", cfg.A, cfg.Server.Addr)
+	}
+
+	// Each value is resolved once, by the provider that read it, and
+	// values that weren't read aren't resolved at all.
+	providers = []Provider{env.WithPrefix("secrets").WithVars(map[string]string{"SECRETS_SERVER_ADDR": "stub://addr"})}
+	cfg = &Config{Server: &Server{}}
+	if err := Parse(cfg, WithSecretResolver(stub)); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.A != "hunter2" || cfg.Server.Addr != "hunter2" {
+		t.Errorf("expected secrets to be resolved, got '%s' and '%s'", cfg.A, cfg.Server.Addr)
+	}
+	if len(resolved) != 2 {
+		t.Errorf("expected 2 secrets resolved through the stub, got %v", resolved)
+	}
+
+	providers = []Provider{}
+	cfg = &Config{Server: &Server{Addr: "stub://default"}}
+	if err := Parse(cfg, WithSecretResolver(stub)); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != "stub://default" {
+		t.Errorf("expected a value no provider read to be left alone, got '%s'", cfg.Server.Addr)
+	}
+
+	// The resolver given to one call isn't kept for the next.
+	providers = []Provider{env.WithPrefix("secrets").WithVars(map[string]string{"SECRETS_SERVER_ADDR": "stub://addr"})}
+	for _, opts := range [][]Option{{WithSecretResolver(stub)}, nil} {
+		cfg = &Config{Server: &Server{}}
+		if err := Parse(cfg, opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cfg.Server.Addr != "stub://addr" {
+		t.Errorf("expected the second call not to resolve secrets, got '%s'", cfg.Server.Addr)
+	}
+}
+
+func TestFileExtensions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"app.hcl":        "server {\n  addr = \":9093\"\n}\n",
+		"app.jsonc":      "{\n  // Local\n  server: {addr: ':9094',},\n}\n",
+		"app.ini":        "[server]\naddr = :9091\n",
+		"app.properties": "server.addr=:9092\n",
+	}
+
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		os.Args = []string{"app", path}
+		providers = []Provider{}
+
+		cfg := &Config{Server: &Server{}}
+		if err := Parse(cfg); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if cfg.Server.Addr == "" {
+			t.Errorf("%s: expected the address to be set", name)
+		}
+	}
+}
+
+func TestFromReader(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"json", `{"Server": {"Addr": ":9090"}}`},
+		{"jsonc", "// Local\n{Server: {Addr: ':9090'},}"},
+		{"toml", "# Local\n[Server]\nAddr = \":9090\"\n"},
+		{"toml assignment", "abcd = \"x\"\n\n[Server]\nAddr = \":9090\"\n"},
+		{"yaml", "server:\n  addr: \":9090\"\n"},
+		{"yaml document", "---\nserver:\n  addr: :9090\n"},
+	}
+
+	for _, test := range tests {
+		cfg := &Config{}
+		if err := FromReader(strings.NewReader(test.in)).Parse(cfg); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if cfg.Server == nil || cfg.Server.Addr != ":9090" {
+			t.Errorf("%s: expected '%s', got %v", test.name, ":9090", cfg.Server)
+		}
+	}
+
+	if err := FromBytes([]byte("# Nothing\n\n")).Parse(&Config{}); err != nil {
+		t.Errorf("expected an empty document to be accepted, got %v", err)
+	}
+
+	if err := FromBytes([]byte("<config/>")).Parse(&Config{}); err != ErrUnknownFormat {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestStdin(t *testing.T) {
+	args, in := os.Args, stdin
+	defer func() { os.Args, stdin = args, in }()
+
+	tests := []struct {
+		args []string
+		in   string
+		opts []Option
+	}{
+		{[]string{"app", "--config", "-"}, `{"Server": {"Addr": ":9090"}}`, nil},
+		{[]string{"app", "-b", "-config=-"}, "[Server]\nAddr = \":9090\"\n", nil},
+		{[]string{"app", "-"}, "server:\n  addr: :9090\n", nil},
+		{[]string{"app", "--config", "-"}, "server {\n  addr = \":9090\"\n}\n", []Option{Format("hcl")}},
+	}
+
+	for _, test := range tests {
+		os.Args = test.args
+		stdin = strings.NewReader(test.in)
+		providers = []Provider{flags.New()}
+
+		cfg := &Config{}
+		if err := Parse(cfg, test.opts...); err != nil {
+			t.Errorf("%v: %v", test.args, err)
+			continue
+		}
+
+		if cfg.Server == nil || cfg.Server.Addr != ":9090" {
+			t.Errorf("%v: expected '%s', got %v", test.args, ":9090", cfg.Server)
+		}
+	}
+}
+
+func TestFlagValue(t *testing.T) {
+	tests := []struct {
+		args  []string
+		value string
+		ok    bool
+	}{
+		{[]string{"--config", "app.json"}, "app.json", true},
+		{[]string{"-config", "app.json"}, "app.json", true},
+		{[]string{"--config=app.json"}, "app.json", true},
+		{[]string{"-config=app.json"}, "app.json", true},
+		{[]string{"config", "app.json"}, "", false},
+		{[]string{"run", "config=app.json"}, "", false},
+		{[]string{"--", "--config", "app.json"}, "", false},
+		{[]string{"--config"}, "", false},
+	}
+
+	for _, test := range tests {
+		value, ok := flagValue(test.args, "config")
+		if value != test.value || ok != test.ok {
+			t.Errorf("%v: expected %q, %t, got %q, %t", test.args, test.value, test.ok, value, ok)
+		}
+	}
+}
+
+func TestMissingConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	missing := filepath.Join(dir, "missing.json")
+	os.Args = []string{"app", "--config=" + missing}
+	providers = []Provider{}
+	if err := Parse(&Config{}); err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("expected an error reading %s, got %v", missing, err)
+	}
+
+	unknown := filepath.Join(dir, "app.conf")
+	if err := ioutil.WriteFile(unknown, []byte("addr = :9090\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Args = []string{"app", "--config", unknown}
+	providers = []Provider{}
+	if err := Parse(&Config{}); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("expected an unsupported file error, got %v", err)
+	}
+
+	// The first argument may not be a configuration file at all.
+	os.Args = []string{"app", "serve"}
+	providers = []Provider{env.New()}
+	if err := Parse(&Config{}); err != nil {
+		t.Errorf("expected a missing positional file to be ignored, got %v", err)
+	}
+}
+
+func TestConfigTag(t *testing.T) {
+	type Database struct {
+		User string `config:"user"`
+	}
+	type Tagged struct {
+		ListenAddr string    `config:"listenAddr"`
+		Port       int64     `config:"port" json:"http_port"`
+		DB         *Database `config:"database"`
+		Ignored    string    `config:"-"`
+	}
+
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"app", "--listen-addr", ":80", "--port", "80", "--database-user", "flag", "--ignored", "x"}
+
+	tests := []struct {
+		name string
+		p    Provider
+		err  bool
+	}{
+		{"json", json.WithReader(strings.NewReader(`{"listenAddr": ":80", "http_port": 80, "database": {"user": "json"}, "ignored": "x"}`)), false},
+		{"yaml", yaml.WithReader(strings.NewReader("listenAddr: :80\nport: 80\ndatabase:\n  user: yaml\nignored: x\n")), false},
+		{"toml", toml.WithReader(strings.NewReader("listenAddr = \":80\"\nport = 80\nignored = \"x\"\n[database]\nuser = \"toml\"\n")), false},
+		{"env", env.WithPrefix("app").WithVars(map[string]string{"APP_LISTEN_ADDR": ":80", "APP_PORT": "80", "APP_DATABASE_USER": "env", "APP_IGNORED": "x"}), false},
+		{"flag", flags.New(), true},
+	}
+
+	for _, test := range tests {
+		cfg := &Tagged{DB: &Database{}}
+		err := test.p.Parse(cfg)
+		if (err != nil) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+
+		if test.err {
+			// The flag provider stops at --ignored, which isn't defined.
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Key != "ignored" {
+				t.Errorf("%s: expected --ignored to be undefined, got %v", test.name, err)
+			}
+		}
+
+		if cfg.ListenAddr != ":80" || cfg.Port != 80 || cfg.DB == nil || cfg.DB.User != test.name || cfg.Ignored != "" {
+			t.Errorf("%s: got %+v %+v", test.name, cfg, cfg.DB)
+		}
+	}
+}
+
+func TestNaming(t *testing.T) {
+	type Named struct {
+		ProxyAddr string
+		BaseURL   string
+		Server    *Server
+	}
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.yaml")
+	if err := ioutil.WriteFile(path, []byte("proxy_addr: file\nbase_url: file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"app", "--base-url", "flag", "--config", path}
+
+	os.Setenv("APP_PROXY_ADDR", "env")
+	os.Setenv("APP_SERVER_ADDR", "env")
+	defer os.Unsetenv("APP_PROXY_ADDR")
+	defer os.Unsetenv("APP_SERVER_ADDR")
+
+	providers = []Provider{env.WithPrefix("app"), flags.New()}
+
+	cfg := &Named{Server: &Server{}}
+	err = Parse(cfg, WithNaming(Naming{Env: naming.ScreamingSnake, Flag: naming.Kebab, File: naming.Snake}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files are parsed last so take precedence.
+	if cfg.ProxyAddr != "file" || cfg.BaseURL != "file" || cfg.Server.Addr != "env" {
+		t.Errorf("got %+v %+v", cfg, cfg.Server)
+	}
+
+	os.Args = []string{"app", "--base-url", "flag"}
+	providers = []Provider{env.WithPrefix("app"), flags.New()}
+
+	cfg = &Named{Server: &Server{}}
+	if err := Parse(cfg, WithNaming(Naming{Env: naming.ScreamingSnake, Flag: naming.Kebab})); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.ProxyAddr != "env" || cfg.BaseURL != "flag" {
+		t.Errorf("got %+v", cfg)
+	}
+}
+
+type Common struct {
+	LogLevel string
+}
+
+type Region struct {
+	Region string
+}
+
+type Postgres struct {
+	Host string
+}
+
+type Service struct {
+	Common
+	DB    Postgres `prefix:"db"`
+	Extra Region   `config:",inline"`
+}
+
+func TestEmbedded(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"app", "--log-level", "flag", "--db-host", "flag", "--region", "flag"}
+
+	tests := []struct {
+		name string
+		p    Provider
+	}{
+		{"json", json.WithReader(strings.NewReader(`{"LogLevel": "json", "db": {"Host": "json"}, "Region": "json"}`))},
+		{"yaml", yaml.WithReader(strings.NewReader("loglevel: yaml\ndb:\n  host: yaml\nregion: yaml\n"))},
+		{"toml", toml.WithReader(strings.NewReader("LogLevel = \"toml\"\nRegion = \"toml\"\n[db]\nHost = \"toml\"\n"))},
+		{"env", env.WithPrefix("app").WithVars(map[string]string{"APP_LOGLEVEL": "env", "APP_DB_HOST": "env", "APP_REGION": "env"})},
+		{"flag", flags.New()},
+	}
+
+	for _, test := range tests {
+		cfg := &Service{}
+		if err := test.p.Parse(cfg); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if cfg.LogLevel != test.name || cfg.DB.Host != test.name || cfg.Extra.Region != test.name {
+			t.Errorf("%s: got %+v", test.name, cfg)
+		}
+	}
+}
+
+type Limits struct {
+	Port     int           `min:"1" max:"65535"`
+	Timeout  time.Duration `max:"1m"`
+	Level    string        `oneof:"debug info warn"`
+	Code     string        `len:"2" regexp:"^[a-z]+$"`
+	Endpoint string        `validate:"url"`
+	Addr     string        `validate:"required,hostport"`
+	Dir      string        `validate:"dir-exists"`
+	Tags     []string      `max:"2"`
+}
+
+func TestValidationRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	providers = []Provider{json.WithReader(strings.NewReader(`{}`))}
+
+	valid := &Limits{Port: 80, Timeout: time.Second, Level: "info", Code: "en", Endpoint: "https://example.com", Addr: "localhost:80", Dir: dir}
+	if err := Parse(valid, ValidateRules()); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	providers = []Provider{json.WithReader(strings.NewReader(`{}`))}
+
+	cfg := &Limits{Port: 70000, Timeout: time.Hour, Level: "trace", Code: "EN", Endpoint: "example.com", Dir: filepath.Join(dir, "missing"), Tags: []string{"a", "b", "c"}}
+	err = Parse(cfg, ValidateRules())
+	list, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("expected Errors, got %v", err)
+	}
+
+	want := []string{"Port: max=65535", "Timeout: max=1m", "Level: oneof=debug info warn", "Code: regexp=^[a-z]+$", "Endpoint: url", "Addr: required", "Dir: dir-exists", "Tags: max=2"}
+	if len(list) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(list), err)
+	}
+	for i, e := range list {
+		var ruleErr *RuleError
+		if !errors.As(e, &ruleErr) || ruleErr.Path+": "+ruleErr.Rule != want[i] {
+			t.Errorf("expected %q, got %v", want[i], e)
+		}
+	}
+}
+
+func TestForeignRules(t *testing.T) {
+	// Tagged for another validation package.
+	type Contact struct {
+		Email string `validate:"required,email"`
+		Name  string `validate:"min=2"`
+	}
+
+	providers = []Provider{json.WithReader(strings.NewReader(`{}`))}
+	if err := Parse(&Contact{Name: "a"}); err != nil {
+		t.Errorf("expected rules to be off by default, got %v", err)
+	}
+
+	providers = []Provider{json.WithReader(strings.NewReader(`{}`))}
+	err := Parse(&Contact{Email: "not an address", Name: "a"}, ValidateRules())
+	if err != nil {
+		t.Errorf("expected entries that aren't rules to be ignored, got %v", err)
+	}
+
+	providers = []Provider{json.WithReader(strings.NewReader(`{}`))}
+	err = Parse(&Contact{}, ValidateRules())
+	var ruleErr *RuleError
+	if !errors.As(err, &ruleErr) || ruleErr.Path != "Email" || ruleErr.Rule != "required" {
+		t.Errorf("expected Email to be required, got %v", err)
+	}
+}
+
+type Checked struct {
+	Port int `min:"1"`
+}
+
+var errChecked = errors.New("checked")
+
+func (c *Checked) Validate() error {
+	return errChecked
+}
+
+func TestValidatorErrors(t *testing.T) {
+	providers = []Provider{json.WithReader(strings.NewReader(`{}`))}
+
+	err := Parse(&Checked{}, ValidateRules())
+	list, ok := err.(Errors)
+	if !ok || len(list) != 2 {
+		t.Fatalf("expected two errors, got %v", err)
+	}
+
+	var ruleErr *RuleError
+	if !errors.As(list[0], &ruleErr) || ruleErr.Path != "Port" {
+		t.Errorf("expected a rule error for Port, got %v", list[0])
+	}
+	if list[1] != errChecked {
+		t.Errorf("expected %v, got %v", errChecked, list[1])
+	}
+}
+
+func TestSchema(t *testing.T) {
+	type Database struct {
+		Host string `usage:"Database host" validate:"required"`
+	}
+	type App struct {
+		Common
+		Port     int           `min:"1" max:"65535"`
+		Level    string        `oneof:"debug info"`
+		Timeout  time.Duration `json:"timeout"`
+		Tags     []string
+		Database Database `prefix:"db"`
+	}
+
+	buf, err := Schema(&App{Port: 8080, Timeout: time.Second, Tags: []string{"a"}}, WithNaming(Naming{File: naming.Snake}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema map[string]interface{}
+	if err := stdjson.Unmarshal(buf, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"$schema":"https://json-schema.org/draft/2020-12/schema","properties":{"db":{"properties":{"host":{"description":"Database host","type":"string"}},"required":["host"],"type":"object"},"level":{"enum":["debug","info"],"type":"string"},"log_level":{"type":"string"},"port":{"default":8080,"maximum":65535,"minimum":1,"type":"integer"},"tags":{"default":["a"],"items":{"type":"string"},"type":"array"},"timeout":{"default":"1s","type":["string","integer"]}},"type":"object"}`
+	got, _ := stdjson.Marshal(schema)
+	if string(got) != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	if _, err := Schema(42); err == nil {
+		t.Error("expected an error for a non-struct")
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.yaml")
+	if err := ioutil.WriteFile(path, []byte("server:\n  port: 70000\n  mode: fast\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	type Listener struct {
+		Port int
+		Mode string `oneof:"http https"`
+		Host string `validate:"required"`
+	}
+	type App struct {
+		Server Listener
+	}
+
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"app", path}
+
+	schema := []byte(`{
+		"type": "object",
+		"properties": {"server": {"$ref": "#/$defs/server"}},
+		"$defs": {"server": {"properties": {"port": {"type": "integer", "maximum": 65535}}}}
+	}`)
+	providers = []Provider{}
+	err = Parse(&App{}, ValidateSchema(schema), WithNaming(Naming{File: naming.Snake}))
+
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("expected a SchemaError, got %v", err)
+	}
+	if schemaErr.Pointer != "/server/port" || schemaErr.Keyword != "maximum" || schemaErr.File != path || schemaErr.Line != 2 || schemaErr.Column != 9 {
+		t.Errorf("got %+v", schemaErr)
+	}
+
+	// The generated schema leaves the rules to validateRules so each
+	// broken rule is reported once.
+	providers = []Provider{}
+	err = Parse(&App{}, ValidateSchema(nil), ValidateRules(), WithNaming(Naming{File: naming.Snake}))
+	list, _ := err.(Errors)
+
+	var got []string
+	for _, e := range list {
+		var ruleErr *RuleError
+		if errors.As(e, &ruleErr) {
+			got = append(got, ruleErr.Path+": "+ruleErr.Rule)
+		} else {
+			got = append(got, e.Error())
+		}
+	}
+	want := "Server.Mode: oneof=http https, Server.Host: required"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("expected %s, got %s", want, strings.Join(got, ", "))
+	}
+
+	// Keys are named by the tag of the file's format.
+	type Tagged struct {
+		Port int `json:"port" yaml:"listen_port"`
+	}
+	if err := ioutil.WriteFile(path, []byte("listen_port: 70000\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	schema = []byte(`{"properties": {"listen_port": {"maximum": 65535}}}`)
+	providers = []Provider{}
+	err = Parse(&Tagged{}, ValidateSchema(schema))
+	if !errors.As(err, &schemaErr) || schemaErr.Pointer != "/listen_port" || schemaErr.Line != 1 {
+		t.Errorf("expected a SchemaError at /listen_port on line 1, got %v", err)
+	}
+
+	buf, err := Schema(&Tagged{}, Format("yaml"))
+	if err != nil || !strings.Contains(string(buf), `"listen_port"`) {
+		t.Errorf("expected a schema with listen_port, got %s (%v)", buf, err)
+	}
+
+	// Values set to zero in the file are there, and keys no field
+	// reads are checked too.
+	type Flags struct {
+		Debug bool `json:"debug"`
+		Port  int  `json:"port"`
+	}
+	path = filepath.Join(dir, "app.json")
+	if err := ioutil.WriteFile(path, []byte(`{"debug": false, "port": 0, "prot": 1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Args = []string{"app", path}
+	schema = []byte(`{"required": ["debug", "port"], "properties": {"debug": true, "port": {"minimum": 1}}, "additionalProperties": false}`)
+	providers = []Provider{}
+	err = Parse(&Flags{}, ValidateSchema(schema))
+	list, _ = err.(Errors)
+
+	got = nil
+	for _, e := range list {
+		if errors.As(e, &schemaErr) {
+			got = append(got, schemaErr.Pointer+" "+schemaErr.Keyword)
+		}
+	}
+	sort.Strings(got)
+	want = "/port minimum, /prot additionalProperties"
+	if len(got) != len(list) || strings.Join(got, ", ") != want {
+		t.Errorf("expected %s, got %v", want, err)
+	}
+}
+
+type Example struct {
+	Name    string        `usage:"Name of the service"`
+	Port    int           `usage:"Port to listen on"`
+	Timeout time.Duration `usage:"Request timeout"`
+	Debug   bool
+	Hosts   []string
+	Limits  map[string]int
+	DB      *Postgres `prefix:"db"`
+}
+
+func TestGenerateExample(t *testing.T) {
+	providers = []Provider{env.WithPrefix("app"), flags.New()}
+
+	want := &Example{Name: `say "hi"`, Port: 8080, Timeout: time.Minute, Hosts: []string{"a", "b"}, Limits: map[string]int{"max-conns": 10}, DB: &Postgres{Host: "localhost"}}
+	decoders := map[string]func(io.Reader) Provider{
+		"json5": func(r io.Reader) Provider { return json.WithReader(r).Relaxed().WithNaming(naming.Snake) },
+		"yaml":  func(r io.Reader) Provider { return yaml.WithReader(r).WithNaming(naming.Snake) },
+		"toml":  func(r io.Reader) Provider { return toml.WithReader(r).WithNaming(naming.Snake) },
+	}
+
+	for format, decoder := range decoders {
+		var buf bytes.Buffer
+		if err := GenerateExample(&buf, want, format, WithNaming(Naming{File: naming.Snake})); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		if !strings.Contains(buf.String(), "Port to listen on") || !strings.Contains(buf.String(), "env: APP_DB_HOST, flag: --db-host") {
+			t.Errorf("%s: expected usage and sources in comments, got\n%s", format, buf.String())
+		}
+
+		got := &Example{}
+		if err := decoder(&buf).Parse(got); err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %+v, got %+v", format, want, got)
+		}
+	}
+
+	if err := GenerateExample(ioutil.Discard, want, "xml"); err != ErrUnknownFormat {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestGenerateConfigFlag(t *testing.T) {
+	args, out := os.Args, stdout
+	defer func() { os.Args, stdout = args, out }()
+
+	var buf bytes.Buffer
+	os.Args = []string{"app", "--generate-config", "yaml"}
+	stdout = &buf
+	providers = []Provider{flags.New()}
+
+	if err := Parse(&Config{Server: &Server{Addr: ":8080"}}); err != ErrGenerateConfig {
+		t.Fatalf("expected ErrGenerateConfig, got %v", err)
+	}
+	if !strings.Contains(buf.String(), `Addr: ":8080"`) {
+		t.Errorf("expected the server address, got\n%s", buf.String())
+	}
+}
+
+func TestComplete(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"app", "__complete", "region", "e"}
+	providers = []Provider{flags.New()}
+
+	// Nothing matches, so nothing is written to standard output.
+	var asked []string
+	fs := flags.New().WithCompleter("region", func(prefix string) []string {
+		asked = append(asked, prefix)
+		return []string{"us-east"}
+	})
+
+	type Deploy struct {
+		Region string
+	}
+	if err := Parse(&Deploy{}, WithFlags(fs)); err != ErrComplete {
+		t.Fatalf("expected ErrComplete, got %v", err)
+	}
+	if len(asked) != 1 || asked[0] != "e" {
+		t.Errorf("expected the completer to be asked for e, got %v", asked)
+	}
+}
+
+func TestDocs(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"app"}
+	providers = []Provider{env.WithPrefix("app"), flags.New()}
+
+	cfg := &Example{Port: 8080, DB: &Postgres{}}
+	buf, err := Docs(cfg, "markdown", WithNaming(Naming{File: naming.Snake}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []string{
+		"| `port` | `--port` | `APP_PORT` | int | `8080` | Port to listen on |",
+		"| `db.host` | `--db-host` | `APP_DB_HOST` | string |  |  |",
+		"| `hosts` |  |  | list of string |  |  |",
+	} {
+		if !strings.Contains(string(buf), row+"\n") {
+			t.Errorf("expected %q in\n%s", row, buf)
+		}
+	}
+
+	// Naming strategies given to Docs aren't kept by the providers.
+	if _, err := Docs(cfg, "markdown", WithNaming(Naming{Env: naming.Snake, Flag: naming.Snake})); err != nil {
+		t.Fatal(err)
+	}
+	if name := providers[0].(*env.Provider).Names(cfg)["DB.Host"]; name != "APP_DB_HOST" {
+		t.Errorf("expected the env provider to be left alone, got %s", name)
+	}
+	if name := providers[1].(*flags.FlagSet).Names(cfg)["DB.Host"]; name != "db-host" {
+		t.Errorf("expected the flags provider to be left alone, got %s", name)
+	}
+
+	buf, err = Docs(cfg, "man")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{".TH APP 1\n", ".TP\n\\fB\\-\\-port\\fR \\fIint\\fR\nPort to listen on\n.br\nEnvironment: \\fBAPP_PORT\\fR\n.br\nFile key: \\fBPort\\fR\n.br\nDefault: 8080\n"} {
+		if !strings.Contains(string(buf), text) {
+			t.Errorf("expected %q in\n%s", text, buf)
+		}
+	}
+
+	if _, err := Docs(cfg, "html"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+
+	// File keys are named by the tag of the format.
+	type Listen struct {
+		Addr string `json:"listen_addr" yaml:"listen"`
+	}
+	for format, key := range map[string]string{"": "listen_addr", "yaml": "listen"} {
+		buf, err := Docs(&Listen{}, "markdown", Format(format))
+		if err != nil || !strings.Contains(string(buf), "| `"+key+"` |") {
+			t.Errorf("expected the file key %s, got %s (%v)", key, buf, err)
+		}
+	}
+}
+
+type Admin struct {
+	User     string `prompt:"User"`
+	Password string `prompt:"Database password" secret:"true" validate:"required"`
+	Level    string `prompt:"Log level" oneof:"debug info"`
+	Retries  *int   `prompt:"Retries"`
+	Server   Server
+}
+
+func TestPrompt(t *testing.T) {
+	providers = []Provider{env.New().WithVars(map[string]string{"USER": "admin"})}
+
+	var out bytes.Buffer
+	in := strings.NewReader("\nhunter2\nwarn\n2\nmany\n3\n")
+
+	cfg := &Admin{}
+	if err := Parse(cfg, PromptWith(in, &out)); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.User != "admin" || cfg.Password != "hunter2" || cfg.Level != "info" || cfg.Retries == nil || *cfg.Retries != 3 {
+		t.Errorf("got %+v", cfg)
+	}
+
+	want := "Database password: A value is required.\nDatabase password: " +
+		"Log level:\n  1) debug\n  2) info\nChoose 1-2: \"warn\" is not one of the choices.\n" +
+		"Log level:\n  1) debug\n  2) info\nChoose 1-2: " +
+		"Retries: parsing int: strconv.ParseInt: parsing \"many\": invalid syntax\nRetries: "
+	if out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+
+	providers = []Provider{env.New().WithVars(map[string]string{})}
+	cfg = &Admin{}
+	err := Parse(cfg, PromptWith(strings.NewReader(""), ioutil.Discard), ValidateRules())
+
+	var ruleErr *RuleError
+	if !errors.As(err, &ruleErr) || ruleErr.Path != "Password" {
+		t.Errorf("expected the password to be required once the input ran out, got %v", err)
+	}
+}
@@ -0,0 +1,354 @@
+// Package crypt decrypts values in configuration files that were
+// encrypted in the style of sops, so that files containing secrets
+// can be committed. An encrypted value looks like
+//
+//	ENC[AES256_GCM,data:...,iv:...,tag:...,type:str]
+//
+// where data, iv and tag are base64 encoded and type records
+// whether the plaintext was a str, int, float or bool.
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/internal/locate"
+	"github.com/ande980/config/internal/walk"
+)
+
+// Cipher is the cipher name written by the AESGCM Encrypter.
+const Cipher = "AES256_GCM"
+
+// Value is an encrypted value as it appears in a file.
+type Value struct {
+	Cipher string
+	Data   []byte
+	IV     []byte
+	Tag    []byte
+	Type   string
+}
+
+// valueRe matches the whole ENC[...] form. Anything that merely
+// starts with ENC[ and ends with ] is left alone as literal text.
+var valueRe = regexp.MustCompile(`ENC\[(\w+),data:([A-Za-z0-9+/]*=*),iv:([A-Za-z0-9+/]+=*),tag:([A-Za-z0-9+/]+=*),type:(\w+)\]`)
+
+// IsEncrypted reports whether s is an encrypted value, and nothing
+// else, in the ENC[cipher,data:...,iv:...,tag:...,type:...] form.
+func IsEncrypted(s string) bool {
+	loc := valueRe.FindStringIndex(s)
+	return loc != nil && loc[0] == 0 && loc[1] == len(s)
+}
+
+// ParseValue parses the ENC[...] form of an encrypted value.
+func ParseValue(s string) (*Value, error) {
+	if !IsEncrypted(s) {
+		return nil, fmt.Errorf("not an encrypted value")
+	}
+
+	m := valueRe.FindStringSubmatch(s)
+	v := &Value{Cipher: m[1], Type: m[5]}
+	for i, field := range []struct {
+		name string
+		dst  *[]byte
+	}{{"data", &v.Data}, {"iv", &v.IV}, {"tag", &v.Tag}} {
+		buf, err := base64.StdEncoding.DecodeString(m[i+2])
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s: %v", field.name, err)
+		}
+		*field.dst = buf
+	}
+	return v, nil
+}
+
+// String returns the ENC[...] form of v.
+func (v *Value) String() string {
+	enc := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("ENC[%s,data:%s,iv:%s,tag:%s,type:%s]", v.Cipher, enc(v.Data), enc(v.IV), enc(v.Tag), v.Type)
+}
+
+// Decrypter decrypts a value. Implementations should return an
+// error for a cipher they don't understand.
+type Decrypter interface {
+	Decrypt(v *Value) ([]byte, error)
+}
+
+// Encrypter encrypts a plaintext of the given type.
+type Encrypter interface {
+	Encrypt(plaintext []byte, typ string) (*Value, error)
+}
+
+// AESGCM is the built in Decrypter and Encrypter using AES-256 in
+// Galois/Counter Mode.
+type AESGCM struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCM returns an AESGCM using key, which must be 32 bytes.
+func NewAESGCM(key []byte) (*AESGCM, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCM{aead}, nil
+}
+
+// Decrypt implements the Decrypter interface.
+func (a *AESGCM) Decrypt(v *Value) ([]byte, error) {
+	if v.Cipher != Cipher {
+		return nil, fmt.Errorf("unsupported cipher %s", v.Cipher)
+	}
+	if len(v.IV) != a.aead.NonceSize() {
+		return nil, fmt.Errorf("iv must be %d bytes, got %d", a.aead.NonceSize(), len(v.IV))
+	}
+
+	plaintext, err := a.aead.Open(nil, v.IV, append(append([]byte{}, v.Data...), v.Tag...), nil)
+	if err != nil {
+		return nil, errors.New("decryption failed")
+	}
+	return plaintext, nil
+}
+
+// Encrypt implements the Encrypter interface.
+func (a *AESGCM) Encrypt(plaintext []byte, typ string) (*Value, error) {
+	iv := make([]byte, a.aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	sealed := a.aead.Seal(nil, iv, plaintext, nil)
+	split := len(sealed) - a.aead.Overhead()
+	return &Value{Cipher: Cipher, Data: sealed[:split], IV: iv, Tag: sealed[split:], Type: typ}, nil
+}
+
+// GenerateKey returns a new random key for NewAESGCM.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// KeyFromFile reads a base64 encoded key from the file at path.
+func KeyFromFile(path string) ([]byte, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key: %v", err)
+	}
+	return decodeKey(string(buf))
+}
+
+// KeyFromEnv reads a base64 encoded key from the environmental
+// variable name.
+func KeyFromEnv(name string) ([]byte, error) {
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("reading key: %s is not set", name)
+	}
+	return decodeKey(val)
+}
+
+func decodeKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("decoding key: %v", err)
+	}
+	return key, nil
+}
+
+// Error is returned by Decrypt for a value that couldn't be
+// decrypted. Offset is the position of the value in the input.
+type Error struct {
+	Offset int
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("decrypting value: %v", e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Decrypt replaces every encrypted value in the raw text of a
+// JSON, TOML or YAML file with its plaintext, including any quotes
+// around it. Strings are written as JSON strings, which all three
+// formats accept, and other types are written bare.
+func Decrypt(buf []byte, d Decrypter) ([]byte, error) {
+	var out bytes.Buffer
+	consumed := 0
+	for {
+		loc := valueRe.FindIndex(buf)
+		if loc == nil {
+			out.Write(buf)
+			return out.Bytes(), nil
+		}
+		idx, end := loc[0], loc[1]
+
+		start := idx
+		if start > 0 && end < len(buf) && (buf[start-1] == '"' || buf[start-1] == '\'') && buf[end] == buf[start-1] {
+			start--
+			end++
+		}
+
+		plaintext, err := decrypt(string(buf[idx:loc[1]]), d)
+		if err != nil {
+			return nil, &Error{Offset: consumed + start, Err: err}
+		}
+
+		out.Write(buf[:start])
+		out.WriteString(plaintext)
+		buf = buf[end:]
+		consumed += end
+	}
+}
+
+// decrypt returns the plaintext of s encoded for a file.
+func decrypt(s string, d Decrypter) (string, error) {
+	plaintext, err := DecryptValue(s, d)
+	if err != nil {
+		return "", err
+	}
+
+	if typ := valueRe.FindStringSubmatch(s)[5]; typ == "str" {
+		quoted, _ := json.Marshal(plaintext)
+		return string(quoted), nil
+	}
+	return plaintext, nil
+}
+
+// DecryptValue returns the plaintext of s, a value in the ENC[...]
+// form, as it was before it was encrypted.
+func DecryptValue(s string, d Decrypter) (string, error) {
+	v, err := ParseValue(s)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := d.Decrypt(v)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Struct decrypts every string field in i, a pointer to a struct,
+// that holds nothing but an encrypted value in the full ENC[...]
+// form. This covers values from providers that don't read files,
+// such as env and flags.
+func Struct(i interface{}, d Decrypter) error {
+	var result errs.Errors
+	walk.Strings(reflect.ValueOf(i), func(path string, field reflect.Value) {
+		s := field.String()
+		if !IsEncrypted(s) {
+			return
+		}
+
+		plaintext, err := DecryptValue(s, d)
+		if err == nil {
+			field.SetString(plaintext)
+			return
+		}
+		result = append(result, &errs.FieldError{Path: path, Source: "crypt", Err: err})
+	})
+	return result.ErrorOrNil()
+}
+
+// EncryptFile encrypts the value of key, a dotted path such as
+// server.password, in the file at path and rewrites the file with
+// everything else left as it was. The format is chosen by the
+// file's extension: .json, .toml, .yaml or .yml.
+func EncryptFile(path, key string, e Encrypter) error {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading configuration file: %v", err)
+	}
+
+	keys := strings.Split(key, ".")
+	var span locate.Span
+	var ok, quoteResult bool
+	switch filepath.Ext(path) {
+	case ".json":
+		span, ok = locate.JSON(buf, keys)
+		quoteResult = true
+	case ".toml":
+		span, ok = locate.TOML(buf, keys)
+		quoteResult = true
+	case ".yaml", ".yml":
+		span, ok = locate.YAML(buf, keys)
+	default:
+		return fmt.Errorf("unsupported configuration file %s", path)
+	}
+	if !ok {
+		return fmt.Errorf("%s: no value for %s", path, key)
+	}
+
+	raw := string(buf[span.Start:span.End])
+	if IsEncrypted(strings.Trim(raw, `"'`)) {
+		return fmt.Errorf("%s: %s is already encrypted", path, key)
+	}
+
+	plaintext, typ := plain(raw)
+	v, err := e.Encrypt([]byte(plaintext), typ)
+	if err != nil {
+		return fmt.Errorf("encrypting %s: %v", key, err)
+	}
+
+	enc := v.String()
+	if quoteResult {
+		enc = strconv.Quote(enc)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	out := append(append(append([]byte{}, buf[:span.Start]...), enc...), buf[span.End:]...)
+	return ioutil.WriteFile(path, out, info.Mode())
+}
+
+// plain unquotes a scalar as written in a file and guesses its type.
+func plain(raw string) (string, string) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		if s, err := strconv.Unquote(raw); err == nil {
+			return s, "str"
+		}
+		return strings.Trim(raw, `"`), "str"
+	case strings.HasPrefix(raw, "'"):
+		return strings.Replace(strings.Trim(raw, "'"), "''", "'", -1), "str"
+	case raw == "true" || raw == "false":
+		return raw, "bool"
+	}
+	if _, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return raw, "int"
+	}
+	if _, err := strconv.ParseFloat(raw, 64); err == nil {
+		return raw, "float"
+	}
+	return raw, "str"
+}
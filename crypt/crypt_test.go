@@ -0,0 +1,161 @@
+package crypt
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptFile(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("CRYPT_KEY", base64.StdEncoding.EncodeToString(key))
+	defer os.Unsetenv("CRYPT_KEY")
+
+	key, err = KeyFromEnv("CRYPT_KEY")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewAESGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "crypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name      string
+		in        string
+		key       string
+		decrypted string
+	}{
+		{
+			"app.yaml", "db:\n  user: admin # the user\n  password: \"hunter\\\"2\"\n", "db.password", "db:\n  user: admin # the user\n  password: \"hunter\\\"2\"\n",
+		},
+		{
+			"app.yaml", "db:\n  user: admin # the user\n  port: 5432\n", "db.port", "db:\n  user: admin # the user\n  port: 5432\n",
+		},
+		{
+			"app.json", "{\n  \"db\": {\"password\": \"hunter2\", \"port\": 5432}\n}", "db.password", "{\n  \"db\": {\"password\": \"hunter2\", \"port\": 5432}\n}",
+		},
+		{
+			"app.toml", "[db]\npassword = 'hunter2' # comment\n", "db.password", "[db]\npassword = \"hunter2\" # comment\n",
+		},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(path, []byte(test.in), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := EncryptFile(path, test.key, a); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(buf), "ENC["+Cipher) {
+			t.Errorf("%s: expected an encrypted value, got '%s'", test.name, buf)
+		}
+
+		if err := EncryptFile(path, test.key, a); err == nil {
+			t.Errorf("%s: expected an error encrypting twice", test.name)
+		}
+
+		out, err := Decrypt(buf, a)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(out) != test.decrypted {
+			t.Errorf("%s: expected '%s', got '%s'", test.name, test.decrypted, out)
+		}
+	}
+}
+
+func TestDecryptError(t *testing.T) {
+	key, _ := GenerateKey()
+	a, _ := NewAESGCM(key)
+	v, _ := a.Encrypt([]byte("hunter2"), "str")
+
+	other, _ := GenerateKey()
+	b, _ := NewAESGCM(other)
+
+	in := "a: 1\nb: " + v.String() + "\n"
+	_, err := Decrypt([]byte(in), b)
+
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *Error, got '%v'", err)
+	}
+
+	if e.Offset != strings.Index(in, "ENC[") {
+		t.Errorf("expected offset %d, got %d", strings.Index(in, "ENC["), e.Offset)
+	}
+}
+
+func TestStruct(t *testing.T) {
+	key, _ := GenerateKey()
+	a, _ := NewAESGCM(key)
+	v, _ := a.Encrypt([]byte("hunter2"), "str")
+
+	cfg := &struct {
+		Password string
+		Plain    string
+	}{v.String(), "plain"}
+
+	if err := Struct(cfg, a); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if cfg.Password != "hunter2" || cfg.Plain != "plain" {
+		t.Errorf("expected 'hunter2' and 'plain', got '%s' and '%s'", cfg.Password, cfg.Plain)
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	key, _ := GenerateKey()
+	a, _ := NewAESGCM(key)
+	v, _ := a.Encrypt([]byte("hunter2"), "str")
+
+	in := "a: ENC[not a secret]\nb: " + v.String() + "\nc: ENC[AES256_GCM,data:abc]\n"
+	out, err := Decrypt([]byte(in), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "a: ENC[not a secret]\nb: \"hunter2\"\nc: ENC[AES256_GCM,data:abc]\n"; string(out) != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+
+	cfg := &struct {
+		Plain  string
+		Prefix string
+	}{"ENC[not a secret]", "ENC[x] " + v.String()}
+	if err := Struct(cfg, a); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Plain != "ENC[not a secret]" || cfg.Prefix != "ENC[x] "+v.String() {
+		t.Errorf("expected literal values to be left alone, got %+v", cfg)
+	}
+
+	if _, err := ParseValue("ENC[not a secret]"); err == nil {
+		t.Error("expected an error parsing a literal")
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/ande980/config/internal/detect"
+	"github.com/ande980/config/internal/format"
+)
+
+// ErrUnknownFormat is returned by providers created with FromReader
+// and FromBytes when the content doesn't look like JSON, TOML or YAML,
+// or the Format given isn't one that's supported.
+var ErrUnknownFormat = errors.New("unable to detect configuration format")
+
+// FromReader returns a provider that reads the whole of r when
+// parsing and decodes it as JSON, TOML or YAML depending on what
+// the content looks like. This is useful when the configuration
+// arrives without a file name, such as on stdin or in an HTTP body.
+// Options are applied to the provider chosen as they would be to a
+// configuration file passed to Parse.
+func FromReader(r io.Reader, opts ...Option) Provider {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o.sniff(r)
+}
+
+// FromBytes is FromReader for configuration already in memory.
+func FromBytes(b []byte, opts ...Option) Provider {
+	return FromReader(bytes.NewReader(b), opts...)
+}
+
+// sniff returns a provider that reads r and chooses a decoder
+// based on what it finds, unless a Format has been given.
+func (o *options) sniff(r io.Reader) Provider {
+	return ProviderFunc(func(i interface{}) error {
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("reading configuration: %v", err)
+		}
+
+		name := o.format
+		if name == "" {
+			name = detect.Format(buf)
+		}
+
+		p := o.reader(name, bytes.NewReader(buf))
+		if p == nil {
+			return ErrUnknownFormat
+		}
+		return p.Parse(i)
+	})
+}
+
+// reader returns a provider for r in the format called name, or
+// nil if the format is unknown. An empty name is treated as an
+// empty document.
+func (o *options) reader(name string, r io.Reader) Provider {
+	if name == "" {
+		return ProviderFunc(func(interface{}) error { return nil })
+	}
+	if fn := format.Lookup(name); fn != nil {
+		return fn(r, "", o.fileOptions())
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// Docs returns a reference for the configuration of i, a struct or
+// a pointer to one, in format, either markdown for a table or man
+// for a roff man page. Every option is listed with its flag,
+// environmental variable, file key, type, default and usage text,
+// named as Parse names them with the same options. File keys are
+// named as the json provider names them, or the provider of the
+// Format given. Defaults are the values already set in i.
+func Docs(i interface{}, format string, opts ...Option) ([]byte, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	v := reflect.ValueOf(i)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v = reflect.Zero(v.Type().Elem())
+			break
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, &reflect.ValueError{Method: "config.Docs", Kind: reflect.Struct}
+	}
+
+	envs, flagNames := o.names(v)
+	var rows []*entry
+	leaves(o.entries(v, formatTag(o.format), "", envs, flagNames), "", &rows)
+
+	var buf bytes.Buffer
+	switch format {
+	case "markdown", "md":
+		markdown(&buf, rows)
+	case "man", "roff":
+		man(&buf, rows)
+	default:
+		return nil, fmt.Errorf("unknown documentation format %q", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// leaves adds the entries that hold values to rows, giving each
+// its dotted file key.
+func leaves(entries []*entry, prefix string, rows *[]*entry) {
+	for _, e := range entries {
+		key := e.key
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if e.fields != nil {
+			leaves(e.fields, key, rows)
+			continue
+		}
+		row := *e
+		row.key = key
+		*rows = append(*rows, &row)
+	}
+}
+
+// typeName describes t for a reader rather than a Go programmer.
+func typeName(t reflect.Type) string {
+	switch {
+	case t == durationType:
+		return "duration"
+	case t == timeType:
+		return "time"
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeName(t.Elem())
+	case reflect.Slice, reflect.Array:
+		return "list of " + typeName(t.Elem())
+	case reflect.Map:
+		return "map of " + typeName(t.Elem())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Interface:
+		return "any"
+	case reflect.Struct:
+		return "string"
+	}
+	return t.Kind().String()
+}
+
+// defaultText returns the default of e as it's written in a file,
+// or an empty string if it has none.
+func (e *entry) defaultText() string {
+	value, ok := defaultValue(e.value)
+	if !ok {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return encode(value)
+}
+
+func markdown(buf *bytes.Buffer, rows []*entry) {
+	buf.WriteString("| Key | Flag | Environment | Type | Default | Description |\n")
+	buf.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+
+	code := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return "`" + strings.Replace(s, "|", `\|`, -1) + "`"
+	}
+	for _, row := range rows {
+		flag := row.flag
+		if flag != "" {
+			flag = "--" + flag
+		}
+		usage := strings.Replace(strings.Replace(row.usage, "|", `\|`, -1), "\n", " ", -1)
+		fmt.Fprintf(buf, "| %s | %s | %s | %s | %s | %s |\n",
+			code(row.key), code(flag), code(row.env), typeName(row.value.Type()), code(row.defaultText()), usage)
+	}
+}
+
+func man(buf *bytes.Buffer, rows []*entry) {
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), filepath.Ext(os.Args[0]))
+	fmt.Fprintf(buf, ".TH %s 1\n", roff(strings.ToUpper(name)))
+	buf.WriteString(".SH NAME\n")
+	fmt.Fprintf(buf, "%s \\- configuration reference\n", roff(name))
+	buf.WriteString(".SH OPTIONS\n")
+
+	for _, row := range rows {
+		buf.WriteString(".TP\n")
+		if row.flag != "" {
+			fmt.Fprintf(buf, "\\fB\\-\\-%s\\fR \\fI%s\\fR\n", roff(row.flag), roff(typeName(row.value.Type())))
+		} else {
+			fmt.Fprintf(buf, "\\fB%s\\fR \\fI%s\\fR\n", roff(row.key), roff(typeName(row.value.Type())))
+		}
+
+		var lines []string
+		if row.usage != "" {
+			lines = append(lines, roff(strings.Replace(row.usage, "\n", " ", -1)))
+		}
+		if row.env != "" {
+			lines = append(lines, "Environment: \\fB"+roff(row.env)+"\\fR")
+		}
+		lines = append(lines, "File key: \\fB"+roff(row.key)+"\\fR")
+		if def := row.defaultText(); def != "" {
+			lines = append(lines, "Default: "+roff(def))
+		}
+		buf.WriteString(strings.Join(lines, "\n.br\n") + "\n")
+	}
+}
+
+// roff escapes s for use in the text of a man page.
+func roff(s string) string {
+	s = strings.Replace(s, `\`, `\e`, -1)
+	s = strings.Replace(s, "-", `\-`, -1)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
@@ -0,0 +1,290 @@
+// Package dotenv provides a config provider for .env files. The
+// variables in the file are mapped onto the struct exactly as the
+// env provider maps environmental variables, without the process
+// environment being modified.
+package dotenv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ande980/config/env"
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/naming"
+	"github.com/ande980/config/secret"
+)
+
+// Provider is a config provider that reads from a .env
+// file or io.Reader and scans into the specified struct.
+type Provider struct {
+	r        io.Reader
+	path     string
+	err      error
+	prefix   string
+	naming   naming.Strategy
+	resolver secret.Resolver
+}
+
+// New is the default way to create a dotenv Provider, reading
+// .env in the working directory. The entire file is read when
+// New is called and a reader created from the buffer. If there
+// is an error reading the file it is stored in Provider and
+// returned during Parse.
+func New() *Provider {
+	return WithPath(".env")
+}
+
+// WithPath allows for a non-standard .env file to be
+// specified at runtime. If there is an error reading the file it
+// is stored in Provider and returned during Parse.
+func WithPath(path string) *Provider {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return &Provider{r: strings.NewReader("")} // No-op reader
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	p := &Provider{r: bytes.NewReader(buf), path: path}
+	if err != nil {
+		p.err = fmt.Errorf("reading configuration file: %v", err)
+	}
+	return p
+}
+
+// WithReader accepts a reader and returns a dotenv Provider.
+func WithReader(r io.Reader) *Provider {
+	return &Provider{r: r}
+}
+
+// WithPrefix sets the application prefix, as env.WithPrefix does.
+func (p *Provider) WithPrefix(prefix string) *Provider {
+	p.prefix = prefix
+	return p
+}
+
+// WithNaming sets the strategy used to derive variable names, as
+// env.Provider.WithNaming does.
+func (p *Provider) WithNaming(s naming.Strategy) *Provider {
+	p.naming = s
+	return p
+}
+
+// WithResolver sets the secret.Resolver that values are passed
+// through, as env.Provider.WithResolver does.
+func (p *Provider) WithResolver(r secret.Resolver) *Provider {
+	p.resolver = r
+	return p
+}
+
+// Parse implements the config.Provider interface.
+func (p *Provider) Parse(i interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	buf, err := ioutil.ReadAll(p.r)
+	if err != nil {
+		return fmt.Errorf("reading configuration: %v", err)
+	}
+
+	vars, err := parse(buf)
+	if err != nil {
+		if fe, ok := err.(*errs.FileError); ok {
+			fe.Path = p.path
+		}
+		return err
+	}
+
+	err = env.WithPrefix(p.prefix).WithVars(vars).WithNaming(p.naming).WithResolver(p.resolver).Parse(i)
+	if list, ok := err.(errs.Errors); ok {
+		for _, e := range list {
+			if fe, ok := e.(*errs.FieldError); ok {
+				fe.Source = "dotenv"
+			}
+		}
+	}
+	return err
+}
+
+// parse reads the variables from a .env file. Each line is an
+// optionally exported NAME=value assignment, a comment or blank.
+// Unquoted values end at a # preceded by whitespace and are
+// trimmed. Single quoted values are literal. Double quoted values
+// understand \n, \r, \t, \", \\ and \$ escapes. Both kinds of
+// quoted value can span lines. $NAME and ${NAME} are expanded in
+// unquoted and double quoted values from the variables defined
+// above them, then the process environment, and ${NAME:-default}
+// supplies a default for an unset or empty variable. \$ and \\ are
+// escapes in unquoted values too.
+func parse(buf []byte) (map[string]string, error) {
+	s := strings.Replace(string(buf), "\r\n", "\n", -1)
+	vars := make(map[string]string)
+	lookup := func(name string) string {
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		return os.Getenv(name)
+	}
+
+	line := 1
+	for len(s) > 0 {
+		var text string
+		if idx := strings.IndexByte(s, '\n'); idx >= 0 {
+			text, s = s[:idx], s[idx+1:]
+		} else {
+			text, s = s, ""
+		}
+		start := line
+		line++
+
+		if trimmed := strings.TrimSpace(text); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		trimmed := strings.TrimPrefix(strings.TrimLeft(text, " \t"), "export ")
+
+		eq := strings.IndexByte(trimmed, '=')
+		if eq <= 0 {
+			return nil, &errs.FileError{Format: "dotenv", Line: start, Err: fmt.Errorf("expected NAME=value")}
+		}
+		name := strings.TrimSpace(trimmed[:eq])
+		value := strings.TrimLeft(trimmed[eq+1:], " \t")
+
+		if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+			quote := value[0]
+			value = value[1:]
+			for {
+				if end := closing(value, quote); end >= 0 {
+					value = value[:end]
+					break
+				}
+				if s == "" {
+					return nil, &errs.FileError{Format: "dotenv", Line: start, Key: name, Err: fmt.Errorf("unterminated quoted value")}
+				}
+				var next string
+				if idx := strings.IndexByte(s, '\n'); idx >= 0 {
+					next, s = s[:idx], s[idx+1:]
+				} else {
+					next, s = s, ""
+				}
+				line++
+				value += "\n" + next
+			}
+
+			if quote == '\'' {
+				vars[name] = value
+				continue
+			}
+			vars[name] = expand(value, lookup, true)
+			continue
+		}
+
+		if idx := strings.Index(value, " #"); idx >= 0 {
+			value = value[:idx]
+		}
+		if idx := strings.Index(value, "\t#"); idx >= 0 {
+			value = value[:idx]
+		}
+		vars[name] = expand(strings.TrimSpace(value), lookup, false)
+	}
+	return vars, nil
+}
+
+// closing finds the unescaped closing quote in s.
+func closing(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && quote == '"' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+// expand replaces $NAME, ${NAME} and ${NAME:-default} in s and
+// interprets its escapes. \$ is a literal $ and \\ a literal \.
+// Double quoted values also understand \n, \r, \t and \", while
+// other backslashes in unquoted values are kept. A ${...} holding
+// something other than a variable name, such as ${server.host}, is
+// left as it is.
+func expand(s string, lookup func(string) string, quoted bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i < len(s)-1:
+			i++
+			switch c := s[i]; {
+			case c == '$' || c == '\\':
+				b.WriteByte(c)
+			case !quoted:
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c == 'n':
+				b.WriteByte('\n')
+			case c == 'r':
+				b.WriteByte('\r')
+			case c == 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(c)
+			}
+		case s[i] != '$' || i == len(s)-1:
+			b.WriteByte(s[i])
+		case s[i+1] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				b.WriteByte(s[i])
+				continue
+			}
+			ref := s[i+2 : i+end]
+			name, def := ref, ""
+			if idx := strings.Index(ref, ":-"); idx >= 0 {
+				name, def = ref[:idx], ref[idx+2:]
+			}
+			if !isName(name) {
+				b.WriteByte(s[i])
+				continue
+			}
+			val := lookup(name)
+			if val == "" {
+				val = def
+			}
+			b.WriteString(val)
+			i += end
+		default:
+			end := i + 1
+			for end < len(s) && (s[end] == '_' || isAlnum(s[end])) {
+				end++
+			}
+			if !isName(s[i+1 : end]) {
+				b.WriteByte(s[i])
+				continue
+			}
+			b.WriteString(lookup(s[i+1 : end]))
+			i = end - 1
+		}
+	}
+	return b.String()
+}
+
+// isName reports whether s is a valid variable name.
+func isName(s string) bool {
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '_' && !isAlnum(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,125 @@
+package dotenv
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ande980/config/internal/errs"
+)
+
+type Config struct {
+	A      string
+	B      bool
+	C      time.Duration
+	Cert   string
+	Server *Server
+}
+
+type Server struct {
+	Addr string
+	Host string
+	URL  string
+}
+
+func TestDotenv(t *testing.T) {
+	os.Setenv("DOTENV_HOME", "/home/dotenv")
+	defer os.Unsetenv("DOTENV_HOME")
+
+	cfg := &Config{Server: &Server{}}
+	r := strings.NewReader(`# a comment
+export BUBBLES_A='literal $DOTENV_HOME'
+BUBBLES_B = true # inline comment
+BUBBLES_C=3h
+BUBBLES_CERT="-----BEGIN-----
+abc\tdef
+-----END-----"
+BUBBLES_SERVER_HOST=example.com
+BUBBLES_SERVER_ADDR="${BUBBLES_SERVER_HOST}:${BUBBLES_SERVER_PORT:-8080}"
+BUBBLES_SERVER_URL="https://$BUBBLES_SERVER_HOST\$HOME${DOTENV_HOME}"
+`)
+
+	if err := WithReader(r).WithPrefix("bubbles").Parse(cfg); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if _, ok := os.LookupEnv("BUBBLES_A"); ok {
+		t.Errorf("expected the environment to be left alone")
+	}
+
+	expected := []string{"literal $DOTENV_HOME", "-----BEGIN-----\nabc\tdef\n-----END-----", "example.com:8080", "https://example.com$HOME/home/dotenv"}
+	for i, got := range []string{cfg.A, cfg.Cert, cfg.Server.Addr, cfg.Server.URL} {
+		if got != expected[i] {
+			t.Errorf("expected '%s', got '%s'", expected[i], got)
+		}
+	}
+
+	if !cfg.B {
+		t.Errorf("expected %t, got %t", true, cfg.B)
+	}
+
+	if cfg.C != 3*time.Hour {
+		t.Errorf("expected %s, got %s", 3*time.Hour, cfg.C)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		line int
+	}{
+		{
+			"syntax", "A=1\nnot an assignment\n", 2,
+		},
+		{
+			"unterminated", "A=1\nB=\"abc\n\n", 2,
+		},
+	}
+
+	for _, test := range tests {
+		err := WithReader(strings.NewReader(test.in)).Parse(&Config{})
+
+		var fe *errs.FileError
+		if !errors.As(err, &fe) || fe.Line != test.line {
+			t.Errorf("%s: expected an error on line %d, got '%v'", test.name, test.line, err)
+		}
+	}
+
+	err := WithReader(strings.NewReader("C=forever\n")).Parse(&Config{})
+
+	var fe *errs.FieldError
+	if !errors.As(err, &fe) || fe.Source != "dotenv" || fe.Path != "C" {
+		t.Errorf("expected a dotenv field error for C, got '%v'", err)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{"HOME": "/home/dotenv"}
+	lookup := func(name string) string { return vars[name] }
+
+	tests := []struct {
+		in       string
+		quoted   bool
+		expected string
+	}{
+		{`${HOME}/bin`, false, "/home/dotenv/bin"},
+		{`${server.host}:$PORT`, false, "${server.host}:"},
+		{`${a.b:-x} ${1}`, true, "${a.b:-x} ${1}"},
+		{`\$HOME`, false, "$HOME"},
+		{`\\$HOME`, false, `\/home/dotenv`},
+		{`\\\$HOME`, true, `\$HOME`},
+		{`C:\dir\n`, false, `C:\dir\n`},
+		{`a\tb\n`, true, "a\tb\n"},
+		{`cost $5`, false, "cost $5"},
+	}
+
+	for _, test := range tests {
+		if got := expand(test.in, lookup, test.quoted); got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.in, test.expected, got)
+		}
+	}
+}
@@ -1,19 +1,34 @@
 package env
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"reflect"
-	"strconv"
+	"sort"
 	"strings"
-	"time"
+
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/internal/walk"
+	"github.com/ande980/config/naming"
+	"github.com/ande980/config/secret"
 )
 
+var errUnknown = errors.New("unknown environment variable")
+
 // Provider is a type that implements config.Provider. The
 // default env prefix is an empty string so the zero value
 // is useful.
 type Provider struct {
-	prefix string
+	prefix   string
+	strict   bool
+	warn     io.Writer
+	known    map[string]bool
+	fields   map[string]bool
+	resolver secret.Resolver
+	vars     map[string]string
+	naming   naming.Strategy
 }
 
 // New instantiates an empty usable Provider instance.
@@ -24,7 +39,51 @@ func New() *Provider {
 // WithPrefix allows for a custom application prefix
 // for specified environmental variables.
 func WithPrefix(prefix string) *Provider {
-	return &Provider{prefix}
+	return &Provider{prefix: prefix}
+}
+
+// DisallowUnknown causes Parse to return an error for every
+// environmental variable carrying the provider's prefix that
+// does not map onto a field of the struct. It has no effect
+// without a prefix as there is no way to tell which variables
+// were meant for this application.
+func (p *Provider) DisallowUnknown() *Provider {
+	p.strict = true
+	return p
+}
+
+// WarnUnknown is the lenient version of DisallowUnknown. Unknown
+// variables are reported to w rather than returned from Parse.
+func (p *Provider) WarnUnknown(w io.Writer) *Provider {
+	p.warn = w
+	return p
+}
+
+// WithVars makes the provider read variables from vars rather
+// than the process environment, which is left untouched. Names
+// are mapped onto the struct in exactly the same way.
+func (p *Provider) WithVars(vars map[string]string) *Provider {
+	p.vars = vars
+	return p
+}
+
+// WithResolver sets the secret.Resolver that values are passed
+// through, such as secret.Default() for file:// references. It
+// also enables NAME_FILE variables naming a file to read when NAME
+// isn't set. Without one values are stored as they are.
+func (p *Provider) WithResolver(r secret.Resolver) *Provider {
+	p.resolver = r
+	return p
+}
+
+// WithNaming sets the strategy that turns the names of fields
+// without an env tag, joined to the prefix with underscores, into
+// variable names. naming.ScreamingSnake maps ProxyAddr to
+// APP_PROXY_ADDR. By default names are only upper cased, giving
+// APP_PROXYADDR.
+func (p *Provider) WithNaming(s naming.Strategy) *Provider {
+	p.naming = s
+	return p
 }
 
 // Parse satisfies the config.Provider interface.
@@ -36,10 +95,203 @@ func (p *Provider) Parse(i interface{}) error {
 		return nil
 	}
 
-	return p.visit(v, p.prefix)
+	p.known = make(map[string]bool)
+	p.fields = make(map[string]bool)
+	for _, name := range p.Names(i) {
+		p.fields[strings.ToUpper(name)] = true
+	}
+	result := p.visit(v, p.prefix, "")
+	return result.Append(p.unknown()).ErrorOrNil()
+}
+
+func (p *Provider) getenv(name string) string {
+	if p.vars != nil {
+		return p.vars[name]
+	}
+	return os.Getenv(name)
+}
+
+// environ returns the names of every variable available.
+func (p *Provider) environ() []string {
+	var names []string
+	if p.vars != nil {
+		for name := range p.vars {
+			names = append(names, name)
+		}
+		return names
+	}
+
+	for _, kv := range os.Environ() {
+		names = append(names, strings.SplitN(kv, "=", 2)[0])
+	}
+	return names
+}
+
+func (p *Provider) resolve(val string) (string, error) {
+	if p.resolver == nil {
+		return val, nil
+	}
+	return p.resolver.Resolve(val)
+}
+
+// unknown checks the environment for prefixed variables that
+// were not seen by visit and suggests the closest known name.
+func (p *Provider) unknown() error {
+	if p.prefix == "" || (!p.strict && p.warn == nil) {
+		return nil
+	}
+
+	prefix := strings.ToUpper(p.prefix) + "_"
+	var names []string
+	for _, name := range p.environ() {
+		if strings.HasPrefix(strings.ToUpper(name), prefix) && !p.known[strings.ToUpper(name)] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var result errs.Errors
+	for _, name := range names {
+		err := &errs.FieldError{Source: "env", Key: name, Err: errUnknown}
+		if suggestion := p.suggest(name); suggestion != "" {
+			err.Err = fmt.Errorf("%v (did you mean %s?)", errUnknown, suggestion)
+		}
+		if p.strict {
+			result = append(result, err)
+			continue
+		}
+		fmt.Fprintf(p.warn, "warning: %v\n", err)
+	}
+	return result.ErrorOrNil()
+}
+
+// suggest returns the known name closest to name, or an empty
+// string if nothing is close enough to be a plausible typo.
+func (p *Provider) suggest(name string) string {
+	name = strings.ToUpper(name)
+	best, bestDist := "", len(name)/3+1
+	for known := range p.known {
+		d := distance(name, known)
+		if d < bestDist || (d == bestDist && known < best) {
+			best, bestDist = known, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein edit distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min(vals ...int) int {
+	m := vals[0]
+	for _, v := range vals[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
 }
 
-func (p *Provider) visit(v reflect.Value, prefix string) error {
+// name returns the variable read for f, a field of a struct whose
+// variables start with prefix. ok is false if f is excluded.
+func (p *Provider) name(f reflect.StructField, prefix string) (name string, ok bool) {
+	switch name = f.Tag.Get("env"); name {
+	case "-":
+		return "", false
+	case "":
+		cfg, ok := walk.Config(f)
+		if !ok {
+			return "", false
+		}
+		name = f.Name
+		if cfg != "" {
+			name = naming.ScreamingSnake(cfg)
+		}
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		if p.naming != nil {
+			return p.naming(name), true
+		}
+	}
+	return strings.ToUpper(name), true
+}
+
+// Names returns the variable read for each field of i, a pointer
+// to a struct, keyed by the field's dotted path such as Server.Addr.
+// Only fields of the types variables are read into are included,
+// and fields in nil pointers to structs are included.
+func (p *Provider) Names(i interface{}) map[string]string {
+	names := make(map[string]string)
+	t := reflect.TypeOf(i)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != nil {
+		p.names(t, p.prefix, "", names)
+	}
+	return names
+}
+
+func (p *Provider) names(t reflect.Type, prefix, path string, names map[string]string) {
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		fieldPath := f.Name
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+
+		if walk.Flatten(f, "env") {
+			p.names(ft, prefix, fieldPath, names)
+			continue
+		}
+
+		name, ok := p.name(f, prefix)
+		if !ok || f.PkgPath != "" {
+			continue
+		}
+		if ft.Kind() == reflect.Struct {
+			p.names(ft, name, fieldPath, names)
+			continue
+		}
+		if walk.Settable(ft) {
+			names[fieldPath] = name
+		}
+	}
+}
+
+// visit walks the struct setting fields from the environment.
+// Errors are collected rather than returned early so every
+// bad variable is reported at once.
+func (p *Provider) visit(v reflect.Value, prefix, path string) errs.Errors {
 	if v.Kind() != reflect.Struct {
 		return nil
 	}
@@ -48,118 +300,66 @@ func (p *Provider) visit(v reflect.Value, prefix string) error {
 		return nil
 	}
 
+	var result errs.Errors
 	for i := 0; i < v.NumField(); i++ {
 		field := v.Field(i)
 		field = reflect.Indirect(field)
 
-		name := v.Type().Field(i).Tag.Get("env")
-		if name == "-" {
+		fieldPath := v.Type().Field(i).Name
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+
+		if walk.Flatten(v.Type().Field(i), "env") {
+			result = append(result, p.visit(field, prefix, fieldPath)...)
 			continue
 		}
-		if name == "" {
-			name = v.Type().Field(i).Name
-			if prefix != "" {
-				name = prefix + "_" + name
-			}
+
+		name, ok := p.name(v.Type().Field(i), prefix)
+		if !ok {
+			continue
 		}
-		name = strings.ToUpper(name)
 
 		if field.Kind() == reflect.Struct {
-			if err := p.visit(field, name); err != nil {
-				return err
-			}
+			result = append(result, p.visit(field, name, fieldPath)...)
 			continue
 		}
 
 		if !field.CanAddr() || !field.CanInterface() {
 			continue
 		}
+		p.known[strings.ToUpper(name)] = true
 
-		val := os.Getenv(name)
+		val := p.getenv(name)
+		resolve := p.resolve
+		if file := strings.ToUpper(name + "_FILE"); p.resolver != nil && !p.fields[file] {
+			p.known[file] = true
+			// NAME_FILE=/run/secrets/name is a common alternative
+			// to putting the secret in the environment. Like other
+			// secrets it needs a resolver, but it names a file
+			// explicitly so it's read whatever the resolver's
+			// schemes. NAME_FILE may be another field's variable,
+			// in which case it's only that.
+			if path := p.getenv(name + "_FILE"); val == "" && path != "" {
+				name, val = name+"_FILE", path
+				resolve = func(path string) (string, error) {
+					return secret.Files.Resolve("file://" + path)
+				}
+			}
+		}
 		if val == "" {
 			continue
 		}
 
-		// Special case - has to go first or it clashes with *int64
-		if field.Type() == reflect.TypeOf(time.Second) {
-			dur, err := time.ParseDuration(val)
-			if err != nil {
-				return fmt.Errorf("parsing duration: %v", err)
-			}
-			field.Set(reflect.ValueOf(dur))
+		resolved, err := resolve(val)
+		if err != nil {
+			result = append(result, &errs.FieldError{Path: fieldPath, Source: "env", Key: name, Value: val, Err: err})
 			continue
 		}
 
-		switch field.Kind() {
-		case reflect.String:
-			field.SetString(val)
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			if err := toCorrectIntType(field, val); err != nil {
-				return err
-			}
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			if err := toCorrectUintType(field, val); err != nil {
-				return err
-			}
-		case reflect.Bool:
-			b, err := strconv.ParseBool(val)
-			if err != nil {
-				return fmt.Errorf("parsing bool: %v", err)
-			}
-			field.SetBool(b)
-		case reflect.Float64:
-			f, err := strconv.ParseFloat(val, 64)
-			if err != nil {
-				return fmt.Errorf("parsing float: %v", err)
-			}
-			field.SetFloat(f)
+		if err := walk.Set(field, resolved); err != nil {
+			result = append(result, &errs.FieldError{Path: fieldPath, Source: "env", Key: name, Value: val, Err: err})
 		}
 	}
-	return nil
-}
-
-func toCorrectIntType(v reflect.Value, s string) error {
-	ival, err := strconv.ParseInt(s, 10, 64)
-	if err != nil {
-		return fmt.Errorf("parsing int: %v", err)
-	}
-
-	switch v.Kind() {
-	case reflect.Int:
-		v.Set(reflect.ValueOf(int(ival)))
-	case reflect.Int8:
-		v.Set(reflect.ValueOf(int8(ival)))
-	case reflect.Int16:
-		v.Set(reflect.ValueOf(int16(ival)))
-	case reflect.Int32:
-		v.Set(reflect.ValueOf(int32(ival)))
-	case reflect.Int64:
-		v.SetInt(ival)
-	default:
-		return &reflect.ValueError{Method: "toCorrectIntType", Kind: v.Kind()}
-	}
-	return nil
-}
-
-func toCorrectUintType(v reflect.Value, s string) error {
-	ival, err := strconv.ParseUint(s, 10, 64)
-	if err != nil {
-		return fmt.Errorf("parsing int: %v", err)
-	}
-
-	switch v.Kind() {
-	case reflect.Uint:
-		v.Set(reflect.ValueOf(uint(ival)))
-	case reflect.Uint8:
-		v.Set(reflect.ValueOf(uint8(ival)))
-	case reflect.Uint16:
-		v.Set(reflect.ValueOf(uint16(ival)))
-	case reflect.Uint32:
-		v.Set(reflect.ValueOf(uint32(ival)))
-	case reflect.Uint64:
-		v.SetUint(ival)
-	default:
-		return &reflect.ValueError{Method: "toCorrectUintType", Kind: v.Kind()}
-	}
-	return nil
+	return result
 }
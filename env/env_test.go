@@ -1,9 +1,18 @@
 package env
 
 import (
+	"bytes"
+	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/naming"
+	"github.com/ande980/config/secret"
 )
 
 type Config struct {
@@ -54,3 +63,141 @@ func TestEnv(t *testing.T) {
 		t.Errorf("expected '%s', got '%s'", ":9090", cfg.Server.Addr)
 	}
 }
+
+func TestUnknown(t *testing.T) {
+	cfg := &Config{Server: &Server{}}
+
+	os.Setenv("UNKNOWN_SERVR_ADDR", ":9090")
+	os.Setenv("UNKNOWN_NOTHING_LIKE_IT", "true")
+	defer os.Unsetenv("UNKNOWN_SERVR_ADDR")
+	defer os.Unsetenv("UNKNOWN_NOTHING_LIKE_IT")
+
+	err := WithPrefix("unknown").DisallowUnknown().Parse(cfg)
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+
+	list, ok := err.(errs.Errors)
+	if !ok || len(list) != 2 {
+		t.Fatalf("expected 2 errors, got '%v'", err)
+	}
+
+	expected := []string{
+		"env UNKNOWN_NOTHING_LIKE_IT: unknown environment variable",
+		"env UNKNOWN_SERVR_ADDR: unknown environment variable (did you mean UNKNOWN_SERVER_ADDR?)",
+	}
+	for i, err := range list {
+		if err.Error() != expected[i] {
+			t.Errorf("expected '%s', got '%s'", expected[i], err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WithPrefix("unknown").WarnUnknown(&buf).Parse(cfg); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if !strings.Contains(buf.String(), "warning: env UNKNOWN_SERVR_ADDR: unknown environment variable") {
+		t.Errorf("expected a warning, got '%s'", buf.String())
+	}
+}
+
+func TestFieldError(t *testing.T) {
+	os.Setenv("FIELD_SERVER_ADDR", ":9090")
+	os.Setenv("FIELD_B", "maybe")
+	os.Setenv("FIELD_C", "forever")
+	defer os.Unsetenv("FIELD_SERVER_ADDR")
+	defer os.Unsetenv("FIELD_B")
+	defer os.Unsetenv("FIELD_C")
+
+	cfg := &Config{Server: &Server{}}
+	err := WithPrefix("field").Parse(cfg)
+
+	var fe *errs.FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected a *errs.FieldError, got '%v'", err)
+	}
+
+	if fe.Path != "B" || fe.Source != "env" || fe.Key != "FIELD_B" || fe.Value != "maybe" {
+		t.Errorf("expected B env FIELD_B maybe, got %s %s %s %s", fe.Path, fe.Source, fe.Key, fe.Value)
+	}
+
+	if list := err.(errs.Errors); len(list) != 2 {
+		t.Errorf("expected 2 errors, got %d", len(list))
+	}
+
+	if cfg.Server.Addr != ":9090" {
+		t.Errorf("expected '%s', got '%s'", ":9090", cfg.Server.Addr)
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "addr")
+	if err := ioutil.WriteFile(path, []byte(":9090\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("SECRETS_SERVER_ADDR_FILE", path)
+	os.Setenv("SECRETS_A", "stub://a")
+	defer os.Unsetenv("SECRETS_SERVER_ADDR_FILE")
+	defer os.Unsetenv("SECRETS_A")
+
+	stub := secret.Default()
+	stub["stub"] = secret.ResolverFunc(func(value string) (string, error) {
+		return strings.TrimPrefix(value, "stub://") + " from stub", nil
+	})
+
+	cfg := &Config{Server: &Server{}}
+	if err := WithPrefix("secrets").WithResolver(stub).DisallowUnknown().Parse(cfg); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if cfg.A != "a from stub" {
+		t.Errorf("expected '%s', got '%s'", "a from stub", cfg.A)
+	}
+
+	if cfg.Server.Addr != ":9090" {
+		t.Errorf("expected '%s', got '%s'", ":9090", cfg.Server.Addr)
+	}
+}
+
+func TestSecretFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cert")
+	if err := ioutil.WriteFile(path, []byte("contents\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]string{"APP_KEY_FILE": path, "APP_CERT_FILE": path}
+
+	// Without a resolver NAME_FILE isn't read.
+	cfg := &struct{ Key string }{}
+	if err := WithPrefix("app").WithVars(vars).Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Key != "" {
+		t.Errorf("expected the file not to be read, got '%s'", cfg.Key)
+	}
+
+	// CertFile is APP_CERT_FILE, so it isn't also Cert's file.
+	both := &struct{ Key, Cert, CertFile string }{}
+	err = WithPrefix("app").WithVars(vars).WithNaming(naming.ScreamingSnake).WithResolver(secret.Default()).DisallowUnknown().Parse(both)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if both.Key != "contents" || both.Cert != "" || both.CertFile != path {
+		t.Errorf("unexpected configuration %+v", both)
+	}
+}
@@ -0,0 +1,355 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	stdjson "encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ande980/config/env"
+	"github.com/ande980/config/flags"
+	"github.com/ande980/config/internal/walk"
+)
+
+// GenerateExample writes an example configuration file for i, a
+// struct or a pointer to one, to w in format, one of json5, yaml or
+// toml. Every field is written with the value it has in i, so a
+// struct with its defaults filled in gives an example of them, and
+// commented with its usage tag and the environmental variable and
+// flag that set it. The names match those Parse uses with the same
+// options.
+func GenerateExample(w io.Writer, i interface{}, format string, opts ...Option) error {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	v := reflect.ValueOf(i)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v = reflect.Zero(v.Type().Elem())
+			break
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return &reflect.ValueError{Method: "config.GenerateExample", Kind: reflect.Struct}
+	}
+
+	var tag string
+	switch format {
+	case "json5", "jsonc":
+		tag = "json"
+	case "yaml", "yml":
+		tag = "yaml"
+	case "toml":
+		tag = "toml"
+	default:
+		return ErrUnknownFormat
+	}
+
+	envs, flagNames := o.names(v)
+	entries := o.entries(v, tag, "", envs, flagNames)
+
+	b := bufio.NewWriter(w)
+	switch tag {
+	case "json":
+		b.WriteString("{\n")
+		writeJSON5(b, entries, "  ")
+		b.WriteString("}\n")
+	case "yaml":
+		writeYAML(b, entries, "")
+	case "toml":
+		writeTOML(b, entries, nil)
+	}
+	return b.Flush()
+}
+
+// entry is a field as it's described in generated files.
+type entry struct {
+	path    string
+	key     string
+	usage   string
+	env     string
+	flag    string
+	value   reflect.Value
+	example interface{} // The value as it's written in a file
+	fields  []*entry    // The fields of a nested struct
+}
+
+// names returns the environmental variable and flag names of the
+// fields of v, keyed by path, from the env and flags providers
+// Parse would use.
+func (o *options) names(v reflect.Value) (envs, flagNames map[string]string) {
+	ptr := reflect.New(v.Type()).Interface()
+	for _, provider := range o.sources() {
+		switch p := provider.(type) {
+		case *env.Provider:
+			if envs == nil {
+				envs = p.Names(ptr)
+			}
+		case *flags.FlagSet:
+			if flagNames == nil {
+				flagNames = p.Names(ptr)
+			}
+		}
+	}
+	return envs, flagNames
+}
+
+// entries describes the fields of v, a struct, naming them in files
+// by tag.
+func (o *options) entries(v reflect.Value, tag, path string, envs, flagNames map[string]string) []*entry {
+	var list []*entry
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		fieldPath := f.Name
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+
+		field := v.Field(i)
+		for field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				field = reflect.Zero(field.Type().Elem())
+				break
+			}
+			field = field.Elem()
+		}
+
+		if walk.Flatten(f, tag) {
+			list = append(list, o.entries(field, tag, fieldPath, envs, flagNames)...)
+			continue
+		}
+
+		key, ok := walk.Key(f, tag, o.naming.File)
+		if !ok {
+			continue
+		}
+
+		e := &entry{
+			path:    fieldPath,
+			key:     key,
+			usage:   f.Tag.Get("usage"),
+			env:     envs[fieldPath],
+			flag:    flagNames[fieldPath],
+			value:   field,
+			example: o.example(field, tag),
+		}
+		if nested(field) {
+			e.fields = append([]*entry{}, o.entries(field, tag, fieldPath, envs, flagNames)...)
+		}
+		list = append(list, e)
+	}
+	return list
+}
+
+// nested reports whether v is a struct made up of fields rather
+// than a value written as a string.
+func nested(v reflect.Value) bool {
+	if v.Kind() != reflect.Struct || v.Type() == timeType {
+		return false
+	}
+	_, ok := v.Interface().(encoding.TextMarshaler)
+	return !ok
+}
+
+// comments returns the lines describing e.
+func (e *entry) comments() []string {
+	var lines []string
+	if e.usage != "" {
+		lines = append(lines, strings.Split(e.usage, "\n")...)
+	}
+
+	var sources []string
+	if e.env != "" {
+		sources = append(sources, "env: "+e.env)
+	}
+	if e.flag != "" {
+		sources = append(sources, "flag: --"+e.flag)
+	}
+	if len(sources) > 0 {
+		lines = append(lines, strings.Join(sources, ", "))
+	}
+	return lines
+}
+
+// example returns the value of v as it's written in a file, with
+// keys named by tag.
+func (o *options) example(v reflect.Value, tag string) interface{} {
+	if value, ok := literal(v); ok {
+		if list, ok := value.([]interface{}); ok && list == nil {
+			return []interface{}{}
+		}
+		return value
+	}
+	if value, ok := o.tree(v, tag); ok {
+		return value
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Struct:
+		return map[string]interface{}{}
+	case reflect.Slice, reflect.Array:
+		return []interface{}{}
+	}
+	return nil
+}
+
+func encode(value interface{}) string {
+	var buf bytes.Buffer
+	enc := stdjson.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return "null"
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+var (
+	// bareKey matches YAML and TOML keys that needn't be quoted.
+	bareKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+	// identifier matches JSON5 keys that needn't be quoted.
+	identifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+)
+
+func writeJSON5(b *bufio.Writer, entries []*entry, indent string) {
+	for n, e := range entries {
+		if n > 0 {
+			b.WriteString("\n")
+		}
+		for _, line := range e.comments() {
+			fmt.Fprintf(b, "%s// %s\n", indent, line)
+		}
+
+		key := e.key
+		if !identifier.MatchString(key) {
+			key = encode(key)
+		}
+		if e.fields == nil {
+			fmt.Fprintf(b, "%s%s: %s,\n", indent, key, encode(e.example))
+			continue
+		}
+		fmt.Fprintf(b, "%s%s: {\n", indent, key)
+		writeJSON5(b, e.fields, indent+"  ")
+		fmt.Fprintf(b, "%s},\n", indent)
+	}
+}
+
+func writeYAML(b *bufio.Writer, entries []*entry, indent string) {
+	for n, e := range entries {
+		if n > 0 && indent == "" {
+			b.WriteString("\n")
+		}
+		for _, line := range e.comments() {
+			fmt.Fprintf(b, "%s# %s\n", indent, line)
+		}
+
+		key := e.key
+		if !bareKey.MatchString(key) {
+			key = encode(key)
+		}
+		switch {
+		case e.fields == nil:
+			fmt.Fprintf(b, "%s%s: %s\n", indent, key, encode(e.example))
+		case len(e.fields) == 0:
+			fmt.Fprintf(b, "%s%s: {}\n", indent, key)
+		default:
+			fmt.Fprintf(b, "%s%s:\n", indent, key)
+			writeYAML(b, e.fields, indent+"  ")
+		}
+	}
+}
+
+// writeTOML writes the values in entries, then a table for each
+// nested struct as TOML requires.
+func writeTOML(b *bufio.Writer, entries []*entry, table []string) {
+	first := true
+	for _, e := range entries {
+		if e.fields != nil {
+			continue
+		}
+		if !first {
+			b.WriteString("\n")
+		}
+		first = false
+		for _, line := range e.comments() {
+			fmt.Fprintf(b, "# %s\n", line)
+		}
+		value, ok := tomlValue(e.example)
+		if !ok {
+			fmt.Fprintf(b, "# %s =\n", tomlKey(e.key))
+			continue
+		}
+		fmt.Fprintf(b, "%s = %s\n", tomlKey(e.key), value)
+	}
+
+	for _, e := range entries {
+		if e.fields == nil {
+			continue
+		}
+		if !first {
+			b.WriteString("\n")
+		}
+		first = false
+		for _, line := range e.comments() {
+			fmt.Fprintf(b, "# %s\n", line)
+		}
+
+		name := append(table[:len(table):len(table)], tomlKey(e.key))
+		fmt.Fprintf(b, "[%s]\n", strings.Join(name, "."))
+		writeTOML(b, e.fields, name)
+	}
+}
+
+func tomlKey(key string) string {
+	if bareKey.MatchString(key) {
+		return key
+	}
+	return encode(key)
+}
+
+// tomlValue writes value as TOML, with maps as inline tables. TOML
+// has no null so false is returned for nil.
+func tomlValue(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case nil:
+		return "", false
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var pairs []string
+		for _, k := range keys {
+			if elem, ok := tomlValue(value[k]); ok {
+				pairs = append(pairs, tomlKey(k)+" = "+elem)
+			}
+		}
+		if len(pairs) == 0 {
+			return "{}", true
+		}
+		return "{ " + strings.Join(pairs, ", ") + " }", true
+	case []interface{}:
+		var elems []string
+		for _, elem := range value {
+			if s, ok := tomlValue(elem); ok {
+				elems = append(elems, s)
+			}
+		}
+		return "[" + strings.Join(elems, ", ") + "]", true
+	}
+	return encode(value), true
+}
@@ -0,0 +1,370 @@
+package flags
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// completeArg is the hidden first argument completion scripts run
+// the program with to ask for dynamic values.
+const completeArg = "__complete"
+
+// stdout is written to by __complete.
+var stdout io.Writer = os.Stdout
+
+// Completer returns the values a flag can take that start with
+// prefix, for values that can't be known when a completion script
+// is generated.
+type Completer func(prefix string) []string
+
+// command is a subcommand offered by completion scripts.
+type command struct {
+	name   string
+	usage  string
+	config interface{}
+}
+
+// WithCommand adds a subcommand, with the flags defined for the
+// struct i, to the completion scripts written by Completion. Only
+// completion is affected: the program runs the command and parses
+// its flags itself, usually with a FlagSet of its own.
+func (f *FlagSet) WithCommand(name, usage string, i interface{}) *FlagSet {
+	f.commands = append(f.commands, command{name: name, usage: usage, config: i})
+	return f
+}
+
+// WithCompleter sets the function that completes the values of the
+// flag called name. Completion scripts run the program with the
+// hidden arguments __complete, the flag name and the word being
+// completed, and Parse writes the values one per line to standard
+// output before returning ErrComplete.
+func (f *FlagSet) WithCompleter(name string, c Completer) *FlagSet {
+	if f.completers == nil {
+		f.completers = make(map[string]Completer)
+	}
+	f.completers[name] = c
+	return f
+}
+
+// complete answers a __complete request for the flag in args[0]
+// with the word being completed in args[1].
+func (f *FlagSet) complete(w io.Writer, args []string) {
+	if len(args) == 0 {
+		return
+	}
+	c, ok := f.completers[strings.TrimLeft(args[0], "-")]
+	if !ok {
+		return
+	}
+
+	var prefix string
+	if len(args) > 1 {
+		prefix = args[1]
+	}
+	for _, value := range c(prefix) {
+		if strings.HasPrefix(value, prefix) {
+			fmt.Fprintln(w, value)
+		}
+	}
+}
+
+// option is a flag as it's described to a shell.
+type option struct {
+	name    string
+	usage   string
+	value   bool     // The flag takes a value
+	values  []string // The values it can take, from a oneof tag
+	file    bool     // Values are paths to files, from complete:"file"
+	dir     bool     // Values are directories, from complete:"dir"
+	dynamic bool     // Values come from a Completer
+}
+
+// options describes the flags defined for i, followed by the flags
+// every FlagSet defines if root is true.
+func (f *FlagSet) options(i interface{}, root bool) []option {
+	var list []option
+	f.fields(i, func(sf reflect.StructField, name, path string) {
+		t := sf.Type
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		o := option{
+			name:   name,
+			usage:  strings.Split(sf.Tag.Get("usage"), "\n")[0],
+			value:  t.Kind() != reflect.Bool,
+			values: strings.Fields(sf.Tag.Get("oneof")),
+			file:   sf.Tag.Get("complete") == "file",
+			dir:    sf.Tag.Get("complete") == "dir",
+		}
+		_, o.dynamic = f.completers[name]
+		list = append(list, o)
+	})
+
+	if root {
+		list = append(list,
+			option{name: "config", usage: "Path to a configuration file, or - for standard input", value: true, file: true},
+			option{name: "generate-config", usage: "Print an example configuration file and exit", value: true, values: []string{"json5", "yaml", "toml"}},
+			option{name: "help", usage: "Print usage and exit"},
+			option{name: "version", usage: "Print the current version"},
+		)
+	}
+	return list
+}
+
+// Completion writes a completion script for shell, one of bash, zsh
+// or fish, to w. It completes the flags defined for i, a pointer to
+// a struct, and any commands added with WithCommand. Flags with a
+// oneof tag complete its values, those tagged complete:"file" or
+// complete:"dir" complete paths, and those with a Completer ask the
+// program. program is the name the script completes, by default the
+// name of the running binary.
+func (f *FlagSet) Completion(w io.Writer, shell, program string, i interface{}) error {
+	if program == "" {
+		program = filepath.Base(os.Args[0])
+	}
+
+	root := f.options(i, true)
+	commands := make([][]option, len(f.commands))
+	for n, c := range f.commands {
+		commands[n] = f.options(c.config, false)
+	}
+
+	var b strings.Builder
+	switch shell {
+	case "bash":
+		f.bash(&b, program, root, commands)
+	case "zsh":
+		f.zsh(&b, program, root, commands)
+	case "fish":
+		f.fish(&b, program, root, commands)
+	default:
+		return fmt.Errorf("unknown shell %q", shell)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var unsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// function returns a shell function name for program.
+func function(program string) string {
+	return "_" + unsafe.ReplaceAllString(program, "_")
+}
+
+func (f *FlagSet) bash(b *strings.Builder, program string, root []option, commands [][]option) {
+	fn := function(program)
+	fmt.Fprintf(b, "# bash completion for %s\n", program)
+	fmt.Fprintf(b, "%s() {\n", fn)
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	b.WriteString("    local prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	b.WriteString("    local cmd=\"\" i\n")
+
+	var names []string
+	for _, c := range f.commands {
+		names = append(names, c.name)
+	}
+	if len(names) > 0 {
+		b.WriteString("    for ((i = 1; i < COMP_CWORD; i++)); do\n")
+		b.WriteString("        case \"${COMP_WORDS[i]}\" in\n")
+		fmt.Fprintf(b, "            %s) cmd=\"${COMP_WORDS[i]}\"; break ;;\n", strings.Join(names, "|"))
+		b.WriteString("        esac\n")
+		b.WriteString("    done\n")
+	}
+
+	b.WriteString("\n    case \"$cmd $prev\" in\n")
+	values := func(cmd string, opts []option) {
+		for _, o := range opts {
+			if !o.value {
+				continue
+			}
+			fmt.Fprintf(b, "        \"%s --%s\"|\"%s -%s\") ", cmd, o.name, cmd, o.name)
+			switch {
+			case o.dynamic:
+				fmt.Fprintf(b, "COMPREPLY=($(compgen -W \"$(\"${COMP_WORDS[0]}\" %s %s \"$cur\" 2>/dev/null)\" -- \"$cur\"))", completeArg, o.name)
+			case len(o.values) > 0:
+				fmt.Fprintf(b, "COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))", strings.Join(o.values, " "))
+			case o.file:
+				b.WriteString("COMPREPLY=($(compgen -f -- \"$cur\"))")
+			case o.dir:
+				b.WriteString("COMPREPLY=($(compgen -d -- \"$cur\"))")
+			default:
+				b.WriteString("COMPREPLY=()")
+			}
+			b.WriteString("; return ;;\n")
+		}
+	}
+	values("", root)
+	for n, c := range f.commands {
+		values(c.name, commands[n])
+	}
+	b.WriteString("    esac\n\n")
+
+	words := func(opts []option, extra []string) string {
+		var list []string
+		for _, o := range opts {
+			list = append(list, "--"+o.name)
+		}
+		return strings.Join(append(list, extra...), " ")
+	}
+	b.WriteString("    case \"$cmd\" in\n")
+	fmt.Fprintf(b, "        \"\") COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", words(root, names))
+	for n, c := range f.commands {
+		fmt.Fprintf(b, "        %s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", c.name, words(commands[n], nil))
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("}\n")
+	fmt.Fprintf(b, "complete -F %s %s\n", fn, program)
+}
+
+// zshEscape escapes the characters _arguments and _describe give a
+// meaning to in s.
+func zshEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+// zshQuote quotes s as a single argument.
+func zshQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func (f *FlagSet) zsh(b *strings.Builder, program string, root []option, commands [][]option) {
+	fn := function(program)
+	fmt.Fprintf(b, "#compdef %s\n\n", program)
+
+	fmt.Fprintf(b, "%s_dynamic() {\n", fn)
+	b.WriteString("  local -a values\n")
+	fmt.Fprintf(b, "  values=(${(f)\"$(%s %s \"$1\" \"$PREFIX\" 2>/dev/null)\"})\n", program, completeArg)
+	b.WriteString("  compadd -a values\n")
+	b.WriteString("}\n\n")
+
+	specs := func(opts []option, indent string) {
+		for _, o := range opts {
+			spec := "--" + o.name
+			if o.value {
+				spec += "="
+			}
+			if o.usage != "" {
+				spec += "[" + zshEscape(o.usage) + "]"
+			}
+			if o.value {
+				action := " "
+				switch {
+				case o.dynamic:
+					action = "{" + fn + "_dynamic " + o.name + "}"
+				case len(o.values) > 0:
+					action = "(" + strings.Join(o.values, " ") + ")"
+				case o.file:
+					action = "_files"
+				case o.dir:
+					action = "_files -/"
+				}
+				spec += ":" + o.name + ":" + action
+			}
+			fmt.Fprintf(b, "%s%s \\\n", indent, zshQuote(spec))
+		}
+	}
+
+	fmt.Fprintf(b, "%s() {\n", fn)
+	if len(f.commands) == 0 {
+		b.WriteString("  _arguments \\\n")
+		specs(root, "    ")
+		b.WriteString("    && return 0\n")
+		b.WriteString("}\n\n")
+		fmt.Fprintf(b, "%s \"$@\"\n", fn)
+		return
+	}
+
+	b.WriteString("  local context state state_descr line\n")
+	b.WriteString("  typeset -A opt_args\n\n")
+	b.WriteString("  _arguments -C \\\n")
+	specs(root, "    ")
+	b.WriteString("    '1: :->command' \\\n")
+	b.WriteString("    '*:: :->args'\n\n")
+	b.WriteString("  case $state in\n")
+	b.WriteString("    command)\n")
+	b.WriteString("      local -a commands\n")
+	b.WriteString("      commands=(\n")
+	for _, c := range f.commands {
+		fmt.Fprintf(b, "        %s\n", zshQuote(zshEscape(c.name)+":"+c.usage))
+	}
+	b.WriteString("      )\n")
+	b.WriteString("      _describe -t commands command commands\n")
+	b.WriteString("      ;;\n")
+	b.WriteString("    args)\n")
+	b.WriteString("      case $line[1] in\n")
+	for n, c := range f.commands {
+		fmt.Fprintf(b, "        %s)\n", c.name)
+		b.WriteString("          _arguments \\\n")
+		specs(commands[n], "            ")
+		b.WriteString("            && return 0\n")
+		b.WriteString("          ;;\n")
+	}
+	b.WriteString("      esac\n")
+	b.WriteString("      ;;\n")
+	b.WriteString("  esac\n")
+	b.WriteString("}\n\n")
+	fmt.Fprintf(b, "%s \"$@\"\n", fn)
+}
+
+// fishQuote quotes s as a single argument.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func (f *FlagSet) fish(b *strings.Builder, program string, root []option, commands [][]option) {
+	fmt.Fprintf(b, "# fish completion for %s\n", program)
+	fmt.Fprintf(b, "complete -c %s -f\n", program)
+
+	var names []string
+	for _, c := range f.commands {
+		names = append(names, c.name)
+	}
+
+	flags := func(condition string, opts []option) {
+		for _, o := range opts {
+			fmt.Fprintf(b, "complete -c %s", program)
+			if condition != "" {
+				fmt.Fprintf(b, " -n %s", fishQuote(condition))
+			}
+			fmt.Fprintf(b, " -l %s", o.name)
+			if o.value {
+				b.WriteString(" -r")
+				switch {
+				case o.dynamic:
+					fmt.Fprintf(b, " -a %s", fishQuote(fmt.Sprintf("(%s %s %s (commandline -ct))", program, completeArg, o.name)))
+				case len(o.values) > 0:
+					fmt.Fprintf(b, " -a %s", fishQuote(strings.Join(o.values, " ")))
+				case o.file:
+					b.WriteString(" -F")
+				case o.dir:
+					fmt.Fprintf(b, " -a %s", fishQuote("(__fish_complete_directories (commandline -ct))"))
+				}
+			}
+			if o.usage != "" {
+				fmt.Fprintf(b, " -d %s", fishQuote(o.usage))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	var condition string
+	if len(names) > 0 {
+		condition = "not __fish_seen_subcommand_from " + strings.Join(names, " ")
+		for _, c := range f.commands {
+			fmt.Fprintf(b, "complete -c %s -n %s -a %s", program, fishQuote(condition), c.name)
+			if c.usage != "" {
+				fmt.Fprintf(b, " -d %s", fishQuote(c.usage))
+			}
+			b.WriteString("\n")
+		}
+	}
+	flags(condition, root)
+	for n, c := range f.commands {
+		flags("__fish_seen_subcommand_from "+c.name, commands[n])
+	}
+}
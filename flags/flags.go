@@ -8,7 +8,11 @@ import (
 	"reflect"
 	"strings"
 	"time"
-	"unicode"
+
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/internal/walk"
+	"github.com/ande980/config/naming"
+	"github.com/ande980/config/secret"
 )
 
 var (
@@ -16,6 +20,10 @@ var (
 	ErrHelp = errors.New("help requested")
 	// ErrVersion is returned when the -v or --version flags are used.
 	ErrVersion = errors.New("version requested")
+	// ErrComplete is returned when the program is run by a shell
+	// completion script with __complete as its first argument, once
+	// the completions have been written to standard output.
+	ErrComplete = errors.New("completion requested")
 )
 
 // FlagSet embeds a flags.FlagSet for the purposes of defining
@@ -23,26 +31,55 @@ var (
 // to the Parse function.
 type FlagSet struct {
 	*flag.FlagSet
-	version bool
+	version    *bool // Shared by copies, as the flag sets it
+	paths      map[string]string
+	err        error
+	naming     naming.Strategy
+	resolver   secret.Resolver
+	commands   []command
+	completers map[string]Completer
 }
 
 // New instantiates an empty usable flagset ready for parsing.
 func New() *FlagSet {
-	f := &FlagSet{flag.NewFlagSet("", flag.ContinueOnError), false}
-	f.BoolVar(&f.version, "version", false, "Print the current version")
-	f.BoolVar(&f.version, "v", false, "Print the current version")
+	f := &FlagSet{FlagSet: flag.NewFlagSet("", flag.ContinueOnError), paths: make(map[string]string), version: new(bool)}
+	f.BoolVar(f.version, "version", false, "Print the current version")
+	f.BoolVar(f.version, "v", false, "Print the current version")
+	return f
+}
+
+// WithNaming sets the strategy that turns the names of fields
+// without a flag tag, joined to their parent's name with hyphens,
+// into flag names. By default names are hyphenated where the case
+// changes and lower cased, which is the same as naming.Kebab for
+// most names.
+func (f *FlagSet) WithNaming(s naming.Strategy) *FlagSet {
+	f.naming = s
+	return f
+}
+
+// WithResolver sets the secret.Resolver that the values of string
+// flags are passed through, such as secret.Default() for file://
+// references. Without one values are stored as they are.
+func (f *FlagSet) WithResolver(r secret.Resolver) *FlagSet {
+	f.resolver = r
 	return f
 }
 
 // Parse implements the config.Provider interface.
 func (f *FlagSet) Parse(i interface{}) error {
+	if len(os.Args) > 1 && os.Args[1] == completeArg {
+		f.complete(stdout, os.Args[2:])
+		return ErrComplete
+	}
+
 	if err := f.parse(i, os.Args[1:]...); err != nil {
 		if err == flag.ErrHelp {
 			return ErrHelp
 		}
 		return err
 	}
-	if f.version {
+	if *f.version {
 		return ErrVersion
 	}
 	return nil
@@ -56,21 +93,207 @@ func (f *FlagSet) parse(i interface{}, args ...string) error {
 		return nil
 	}
 
-	if err := f.visit(v, ""); err != nil {
+	if err := f.visit(v, "", ""); err != nil {
 		return err
 	}
 
+	// The configuration path is used by config.Parse to choose
+	// providers, and it handles --generate-config, but they have
+	// to be accepted here too. A field can't have either name as
+	// config.Parse would take its value for its own.
+	for _, name := range []string{"config", "generate-config"} {
+		if path, ok := f.paths[name]; ok {
+			return fmt.Errorf("%s: the --%s flag is reserved", path, name)
+		}
+	}
+	if f.Lookup("config") == nil {
+		f.String("config", "", "Path to a configuration file, or - for standard input")
+	}
+	if f.Lookup("generate-config") == nil {
+		f.String("generate-config", "", "Print an example configuration file in json5, yaml or toml and exit")
+	}
+
+	f.VisitAll(func(fl *flag.Flag) {
+		path, ok := f.paths[fl.Name]
+		if !ok {
+			return
+		}
+		val := &value{Value: fl.Value, f: f, path: path, name: fl.Name}
+		if g, ok := fl.Value.(flag.Getter); ok && f.resolver != nil {
+			if _, ok := g.Get().(string); ok {
+				val.resolve = f.resolver.Resolve
+			}
+		}
+		if b, ok := fl.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			fl.Value = &boolValue{val}
+			return
+		}
+		fl.Value = val
+	})
+
 	if err := f.FlagSet.Parse(args); err != nil {
 		if err == flag.ErrHelp {
 			return err
 		}
+		if f.err != nil {
+			return f.err
+		}
+		if strings.HasPrefix(err.Error(), undefined) {
+			name := strings.TrimLeft(strings.TrimPrefix(err.Error(), undefined), "-")
+			return &errs.FieldError{Source: "flag", Key: name, Err: errors.New(strings.TrimSuffix(undefined, ": "))}
+		}
 		return fmt.Errorf("parsing flags: %v", err)
 	}
 
 	return nil
 }
 
-func (f *FlagSet) visit(v reflect.Value, prefix string) error {
+// undefined prefixes the error returned by the flag package when
+// it comes across a flag that hasn't been defined.
+const undefined = "flag provided but not defined: "
+
+// value wraps the flag.Value of a struct field so that a failure
+// to set it can be reported as a FieldError. The flag package
+// only returns a formatted string.
+type value struct {
+	flag.Value
+	f       *FlagSet
+	path    string
+	name    string
+	resolve func(string) (string, error)
+}
+
+// Set implements flag.Value.
+func (v *value) Set(s string) error {
+	if v.resolve != nil {
+		resolved, err := v.resolve(s)
+		if err != nil {
+			v.f.err = &errs.FieldError{Path: v.path, Source: "flag", Key: v.name, Value: s, Err: err}
+			return err
+		}
+		s = resolved
+	}
+	if err := v.Value.Set(s); err != nil {
+		v.f.err = &errs.FieldError{Path: v.path, Source: "flag", Key: v.name, Value: s, Err: err}
+		return err
+	}
+	return nil
+}
+
+type boolValue struct {
+	*value
+}
+
+func (b *boolValue) IsBoolFlag() bool {
+	return true
+}
+
+// name returns the name of the flag for f, a field of a struct
+// whose flags start with prefix. ok is false if f is excluded.
+func (f *FlagSet) name(sf reflect.StructField, prefix string) (name string, ok bool) {
+	name = sf.Tag.Get("flag")
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		cfg, ok := walk.Config(sf)
+		if !ok {
+			return "", false
+		}
+		name = sf.Name
+		if cfg != "" {
+			name = strings.Replace(cfg, "_", "-", -1)
+		}
+		if prefix != "" {
+			name = prefix + "-" + name
+		}
+		if f.naming != nil {
+			name = f.naming(name)
+		}
+	}
+	if f.naming == nil || sf.Tag.Get("flag") != "" {
+		name = canonicalName(name)
+	}
+	return name, true
+}
+
+// Names returns the flag defined for each field of i, a pointer to
+// a struct, keyed by the field's dotted path such as Server.Addr.
+// Only fields of the types flags are defined for are included, and
+// fields in nil pointers to structs are included.
+func (f *FlagSet) Names(i interface{}) map[string]string {
+	names := make(map[string]string)
+	f.fields(i, func(sf reflect.StructField, name, path string) {
+		names[path] = name
+	})
+	return names
+}
+
+// fields calls fn with every field of i, a struct or a pointer to
+// one, that a flag would be defined for, along with the flag's name
+// and the field's path. Fields in nil pointers are included.
+func (f *FlagSet) fields(i interface{}, fn func(sf reflect.StructField, name, path string)) {
+	t := reflect.TypeOf(i)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != nil {
+		f.walk(t, "", "", fn)
+	}
+}
+
+func (f *FlagSet) walk(t reflect.Type, prefix, path string, fn func(sf reflect.StructField, name, path string)) {
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		fieldPath := sf.Name
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+
+		if walk.Flatten(sf, "flag") {
+			f.walk(ft, prefix, fieldPath, fn)
+			continue
+		}
+
+		name, ok := f.name(sf, prefix)
+		if !ok || sf.PkgPath != "" {
+			continue
+		}
+		if ft.Kind() == reflect.Struct {
+			f.walk(ft, name, fieldPath, fn)
+			continue
+		}
+		if supported(ft) {
+			fn(sf, name, fieldPath)
+		}
+	}
+}
+
+// supported reports whether a flag can be defined for a field of
+// type t.
+func supported(t reflect.Type) bool {
+	if t == reflect.TypeOf(time.Second) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func (f *FlagSet) visit(v reflect.Value, prefix, path string) error {
 	if v.Kind() != reflect.Struct {
 		return nil
 	}
@@ -83,20 +306,25 @@ func (f *FlagSet) visit(v reflect.Value, prefix string) error {
 		field := v.Field(i)
 		field = reflect.Indirect(field)
 
-		name := v.Type().Field(i).Tag.Get("flag")
-		if name == "-" {
-			continue
+		fieldPath := v.Type().Field(i).Name
+		if path != "" {
+			fieldPath = path + "." + fieldPath
 		}
-		if name == "" {
-			name = v.Type().Field(i).Name
-			if prefix != "" {
-				name = prefix + "-" + name
+
+		if walk.Flatten(v.Type().Field(i), "flag") {
+			if err := f.visit(field, prefix, fieldPath); err != nil {
+				return err
 			}
+			continue
+		}
+
+		name, ok := f.name(v.Type().Field(i), prefix)
+		if !ok {
+			continue
 		}
-		name = canonicalName(name)
 
 		if field.Kind() == reflect.Struct {
-			if err := f.visit(field, name); err != nil {
+			if err := f.visit(field, name, fieldPath); err != nil {
 				return err
 			}
 			continue
@@ -105,6 +333,7 @@ func (f *FlagSet) visit(v reflect.Value, prefix string) error {
 		if !field.CanAddr() || !field.CanInterface() {
 			continue
 		}
+		f.paths[name] = fieldPath
 
 		usage := v.Type().Field(i).Tag.Get("usage")
 		if usage == "" {
@@ -190,23 +419,5 @@ func toUint64(v reflect.Value) (*uint64, error) {
 }
 
 func canonicalName(name string) string {
-	var canon string
-	for i, r := range name {
-		if unicode.IsUpper(r) {
-			switch {
-			case i == len(name)-1: // last char
-			case len(canon) == 0: // first char
-			default:
-				switch {
-				case unicode.IsLower(rune(name[i-1])):
-					canon += "-"
-				case unicode.IsLower(rune(name[i+1])) && !unicode.IsPunct(rune(canon[len(canon)-1])):
-					canon += "-"
-				}
-			}
-		}
-		canon += string(r)
-	}
-
-	return strings.ToLower(canon)
+	return walk.Kebab(name)
 }
@@ -1,9 +1,15 @@
 package flags
 
 import (
+	"errors"
 	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/ande980/config/internal/errs"
 )
 
 type Config struct {
@@ -43,6 +49,14 @@ func TestFlags(t *testing.T) {
 			if f.Usage != "Print the current version" {
 				t.Errorf("%s: expected '%s', got '%s'", f.Name, "Print the current version", f.Usage)
 			}
+		case "config":
+			if f.Usage != "Path to a configuration file, or - for standard input" {
+				t.Errorf("%s: expected '%s', got '%s'", f.Name, "Path to a configuration file, or - for standard input", f.Usage)
+			}
+		case "generate-config":
+			if f.Usage != "Print an example configuration file in json5, yaml or toml and exit" {
+				t.Errorf("%s: expected '%s', got '%s'", f.Name, "Print an example configuration file in json5, yaml or toml and exit", f.Usage)
+			}
 		default:
 			if f.Usage != "" {
 				t.Errorf("%s: expected '%s', got '%s'", f.Name, "", f.Usage)
@@ -89,3 +103,124 @@ func TestNames(t *testing.T) {
 		}
 	}
 }
+
+func TestFieldError(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		path  string
+		key   string
+		value string
+	}{
+		{
+			"invalid", []string{"-c", "forever"}, "C", "c", "forever",
+		},
+		{
+			"undefined", []string{"--server-port", "80"}, "", "server-port", "",
+		},
+	}
+
+	for _, test := range tests {
+		cfg := &Config{Server: &Server{}}
+		err := New().parse(cfg, test.args...)
+
+		var fe *errs.FieldError
+		if !errors.As(err, &fe) {
+			t.Errorf("%s: expected *errs.FieldError, got '%v'", test.name, err)
+			continue
+		}
+
+		if fe.Path != test.path || fe.Source != "flag" || fe.Key != test.key || fe.Value != test.value {
+			t.Errorf("%s: expected '%s' flag '%s' '%s', got '%s' %s '%s' '%s'", test.name, test.path, test.key, test.value, fe.Path, fe.Source, fe.Key, fe.Value)
+		}
+	}
+}
+
+func TestReserved(t *testing.T) {
+	cfg := &struct {
+		Config string
+		Server struct {
+			Addr string
+		}
+	}{}
+
+	err := New().parse(cfg, "--server-addr", ":80")
+	if err == nil || !strings.Contains(err.Error(), "--config flag is reserved") {
+		t.Errorf("expected the config flag to be reserved, got '%v'", err)
+	}
+}
+
+type Serve struct {
+	Root string `complete:"dir" usage:"Directory to serve"`
+}
+
+type CLI struct {
+	Level string `oneof:"debug info" usage:"Log level"`
+	Cert  string `complete:"file"`
+	Host  string
+	Debug bool
+}
+
+func TestCompletion(t *testing.T) {
+	f := New().WithCommand("serve", "Run the server", &Serve{}).WithCompleter("host", func(string) []string { return nil })
+
+	tests := map[string][]string{
+		"bash": {
+			`"serve --root"|"serve -root") COMPREPLY=($(compgen -d -- "$cur")); return ;;`,
+			`" --level"|" -level") COMPREPLY=($(compgen -W "debug info" -- "$cur")); return ;;`,
+			`" --cert"|" -cert") COMPREPLY=($(compgen -f -- "$cur")); return ;;`,
+			`"${COMP_WORDS[0]}" __complete host "$cur"`,
+			"complete -F _app app\n",
+		},
+		"zsh": {
+			"#compdef app\n",
+			`'--level=[Log level]:level:(debug info)'`,
+			`'--cert=:cert:_files'`,
+			`'--host=:host:{_app_dynamic host}'`,
+			`'serve:Run the server'`,
+			`'--root=[Directory to serve]:root:_files -/'`,
+		},
+		"fish": {
+			"complete -c app -n 'not __fish_seen_subcommand_from serve' -a serve -d 'Run the server'\n",
+			"-l level -r -a 'debug info' -d 'Log level'\n",
+			"-l cert -r -F\n",
+			"-l host -r -a '(app __complete host (commandline -ct))'\n",
+			"complete -c app -n '__fish_seen_subcommand_from serve' -l root -r",
+		},
+	}
+
+	for shell, want := range tests {
+		var b strings.Builder
+		if err := f.Completion(&b, shell, "app", &CLI{}); err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		for _, text := range want {
+			if !strings.Contains(b.String(), text) {
+				t.Errorf("%s: expected %q in\n%s", shell, text, b.String())
+			}
+		}
+	}
+
+	if err := f.Completion(ioutil.Discard, "powershell", "app", &CLI{}); err == nil {
+		t.Error("expected an error for an unknown shell")
+	}
+}
+
+func TestComplete(t *testing.T) {
+	args, out := os.Args, stdout
+	defer func() { os.Args, stdout = args, out }()
+
+	var b strings.Builder
+	stdout = &b
+	os.Args = []string{"app", "__complete", "host", "lo"}
+
+	f := New().WithCompleter("host", func(prefix string) []string {
+		return []string{"localhost", "local", "remote"}
+	})
+	if err := f.Parse(&CLI{}); err != ErrComplete {
+		t.Fatalf("expected ErrComplete, got %v", err)
+	}
+	if b.String() != "localhost\nlocal\n" {
+		t.Errorf("expected localhost and local, got %q", b.String())
+	}
+}
@@ -1,8 +1,9 @@
 module github.com/ande980/config
 
+go 1.16
+
 require (
 	github.com/BurntSushi/toml v0.3.0
-	github.com/hashicorp/errwrap v0.0.0-20180715044906-d6c0cd880357 // indirect
-	github.com/hashicorp/go-multierror v0.0.0-20180717150148-3d5d8f294aa0
+	github.com/hashicorp/hcl v1.0.0
 	gopkg.in/yaml.v2 v2.2.1
 )
@@ -0,0 +1,255 @@
+// Package hcl provides a config provider for HashiCorp
+// Configuration Language files. Importing it, if only for its side
+// effect, is what makes config.Parse read files with a .hcl
+// extension, so programs that don't need HCL don't depend on it:
+//
+//	import _ "github.com/ande980/config/hcl"
+package hcl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ande980/config/crypt"
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/internal/expand"
+	"github.com/ande980/config/internal/format"
+	"github.com/ande980/config/internal/walk"
+	"github.com/ande980/config/naming"
+	"github.com/ande980/config/secret"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/parser"
+)
+
+// Provider is a config provider that reads from an hcl
+// file or io.Reader and scans into the specified struct.
+// Blocks are decoded into nested structs and labelled
+// blocks, such as service "web" { ... }, into maps keyed
+// by label.
+type Provider struct {
+	r         io.Reader
+	path      string
+	err       error
+	expand    bool
+	strict    bool
+	resolver  secret.Resolver
+	decrypter crypt.Decrypter
+	naming    naming.Strategy
+}
+
+func init() {
+	format.Register("hcl", func(r io.Reader, path string, o format.Options) format.Parser {
+		p := WithReader(r)
+		if path != "" {
+			p = WithPath(path)
+		}
+		p.WithResolver(o.Resolver).WithDecrypter(o.Decrypter).WithNaming(o.Naming)
+		if o.Expand {
+			p.ExpandEnv(o.Strict)
+		}
+		return p
+	})
+}
+
+// New is the default way to create an hcl Provider. The entire
+// file is read when New is called and a reader created from
+// the buffer. If there is an error reading the file it
+// is stored in Provider and returned during Parse.
+func New() *Provider {
+	filepathNoExt := strings.TrimSuffix(filepath.Base(os.Args[0]), filepath.Ext(os.Args[0]))
+	return WithPath(filepathNoExt + ".hcl")
+}
+
+// WithPath allows for a non-standard configuration file to be
+// specified at runtime. If there is an error reading the file it
+// is stored in Provider and returned during Parse.
+func WithPath(path string) *Provider {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return &Provider{r: strings.NewReader("")} // No-op reader, but one that doesn't generate io.EOF
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	p := &Provider{r: bytes.NewReader(buf), path: path}
+	if err != nil {
+		p.err = fmt.Errorf("reading configuration file: %v", err)
+	}
+	return p
+}
+
+// WithReader accepts a reader and returns an hcl Provider.
+func WithReader(r io.Reader) *Provider {
+	return &Provider{r: r}
+}
+
+// ExpandEnv enables ${NAME} and ${NAME:-default} placeholders
+// in the file, which are replaced with environmental variables
+// before decoding. $$ is a literal $. An unset variable with no
+// default expands to nothing unless strict is true, in which
+// case Parse returns an error for each one. Values are inserted
+// as they are so they must be valid HCL where they're used.
+func (p *Provider) ExpandEnv(strict bool) *Provider {
+	p.expand = true
+	p.strict = strict
+	return p
+}
+
+// WithResolver sets the secret.Resolver that string values are
+// passed through as they are decoded, such as secret.Default() for
+// file:// references. Without one values are stored as they are.
+func (p *Provider) WithResolver(r secret.Resolver) *Provider {
+	p.resolver = r
+	return p
+}
+
+// WithDecrypter enables decryption of ENC[...] values in the
+// file before decoding. See the crypt package.
+func (p *Provider) WithDecrypter(d crypt.Decrypter) *Provider {
+	p.decrypter = d
+	return p
+}
+
+// WithNaming sets the strategy that turns the names of fields
+// without a tag into keys, such as naming.Snake for proxy_addr.
+// By default field names are matched without regard to case.
+func (p *Provider) WithNaming(s naming.Strategy) *Provider {
+	p.naming = s
+	return p
+}
+
+// Parse implements the config.Provider interface. Decoding
+// errors are returned as a *errs.FileError (config.FileError)
+// locating the problem in the file where the decoder says
+// where it is.
+func (p *Provider) Parse(i interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	buf, err := ioutil.ReadAll(p.r)
+	if err != nil {
+		return fmt.Errorf("reading configuration: %v", err)
+	}
+
+	var m *expand.Map
+	if p.expand {
+		if buf, m, err = expand.File(buf, p.path, "hcl", p.strict); err != nil {
+			return err
+		}
+	}
+
+	if p.decrypter != nil {
+		decrypted, err := crypt.Decrypt(buf, p.decrypter)
+		if err != nil {
+			return m.Locate(p.fileError(buf, err))
+		}
+		buf = decrypted
+	}
+
+	var tree interface{}
+	if err := hcl.Decode(&tree, string(buf)); err != nil {
+		return m.Locate(p.fileError(buf, err))
+	}
+
+	return m.Locate(p.bind(buf, i, tree))
+}
+
+// fileError locates err in the file. Syntax errors carry a
+// position, decrypting errors an offset.
+func (p *Provider) fileError(buf []byte, err error) error {
+	fe := &errs.FileError{Path: p.path, Format: "hcl", Err: err}
+	switch e := err.(type) {
+	case *crypt.Error:
+		fe.Line, fe.Column = errs.Position(buf, int64(e.Offset))
+	case *parser.PosError:
+		fe.Line, fe.Column = e.Pos.Line, e.Pos.Column
+		fe.Err = e.Err
+	}
+	return fe
+}
+
+// bind stores the decoded tree in i. Fields are named by their
+// hcl tag, config tag or field name, and values that can't be
+// stored are reported as FieldErrors located in the file.
+func (p *Provider) bind(buf []byte, i interface{}, tree interface{}) error {
+	b := &walk.Binder{Tag: "hcl", Naming: p.naming, Blocks: true}
+	if p.resolver != nil {
+		b.Resolve = p.resolver.Resolve
+	}
+
+	var result errs.Errors
+	for _, e := range b.Bind(reflect.ValueOf(i), tree) {
+		key := strings.Join(e.Keys, ".")
+		fe := &errs.FileError{Path: p.path, Format: "hcl", Key: key, Err: e.Err}
+		fe.Line, fe.Column = keyLine(buf, e.Keys)
+		result = append(result, &errs.FieldError{Path: e.Path, Source: "hcl", Key: key, Value: e.Value, Err: fe})
+	}
+	return result.ErrorOrNil()
+}
+
+// keyLine finds the value assigned to key by tracking the blocks
+// and labels opened above it, returning its line and column.
+func keyLine(buf []byte, key []string) (int, int) {
+	var blocks [][]string
+	for n, line := range strings.Split(string(buf), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "}") {
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+			continue
+		}
+
+		var path []string
+		for _, b := range blocks {
+			path = append(path, b...)
+		}
+
+		if idx := strings.Index(line, "="); idx > 0 {
+			name := strings.Trim(strings.TrimSpace(line[:idx]), `"`)
+			if equal(append(path, name), key) {
+				value := idx + 1 + len(line[idx+1:]) - len(strings.TrimLeft(line[idx+1:], " \t"))
+				return n + 1, value + 1
+			}
+			if strings.HasSuffix(trimmed, "{") {
+				blocks = append(blocks, []string{name})
+			}
+			continue
+		}
+
+		if strings.HasSuffix(trimmed, "{") && !strings.Contains(trimmed, "}") {
+			var names []string
+			for _, f := range strings.Fields(strings.TrimSuffix(trimmed, "{")) {
+				names = append(names, strings.Trim(f, `"`))
+			}
+			blocks = append(blocks, names)
+		}
+	}
+	return 0, 0
+}
+
+// equal compares a path of block names and labels with key, which
+// may also hold list indexes for repeated blocks.
+func equal(path, key []string) bool {
+	var filtered []string
+	for _, k := range key {
+		if _, err := strconv.Atoi(k); err != nil {
+			filtered = append(filtered, k)
+		}
+	}
+	if len(path) != len(filtered) {
+		return false
+	}
+	for i := range path {
+		if path[i] != filtered[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package hcl
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ande980/config/internal/errs"
+)
+
+type Config struct {
+	A        string `hcl:"abcd"`
+	B        bool
+	Server   *Server
+	Services map[string]Service `hcl:"service"`
+}
+
+type Server struct {
+	Addr string
+	Port int
+}
+
+type Service struct {
+	Port int
+}
+
+func TestHCL(t *testing.T) {
+	cfg := &Config{
+		A:      "test",
+		B:      true,
+		Server: &Server{Addr: ":8080"},
+	}
+
+	r := strings.NewReader(`abcd = "princes of the universe"
+B = false
+
+server {
+  addr = ":9090"
+}
+
+service "web" {
+  port = 80
+}
+
+service "api" {
+  port = 8080
+}`)
+	if err := WithReader(r).Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.A != "princes of the universe" {
+		t.Errorf("expected '%s', got '%s'", "princes of the universe", cfg.A)
+	}
+
+	if cfg.B {
+		t.Errorf("expected %t, got %t", false, cfg.B)
+	}
+
+	if cfg.Server.Addr != ":9090" {
+		t.Errorf("expected '%s', got '%s'", ":9090", cfg.Server.Addr)
+	}
+
+	if cfg.Services["web"].Port != 80 || cfg.Services["api"].Port != 8080 {
+		t.Errorf("expected web:80 and api:8080, got %v", cfg.Services)
+	}
+}
+
+func TestNoFile(t *testing.T) {
+	if err := New().Parse(&Config{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileError(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		line int
+		col  int
+		path string
+	}{
+		{
+			"syntax", "abcd = \"x\"\nB = \n=\n", 3, 1, "",
+		},
+		{
+			"type", "server {\n  port = [1]\n}\n", 2, 10, "Server.Port",
+		},
+	}
+
+	for _, test := range tests {
+		err := WithReader(strings.NewReader(test.in)).Parse(&Config{})
+		var fe *errs.FileError
+		if !errors.As(err, &fe) {
+			t.Errorf("%s: expected *errs.FileError, got %T", test.name, err)
+			continue
+		}
+
+		var fieldErr *errs.FieldError
+		if errors.As(err, &fieldErr) != (test.path != "") || (fieldErr != nil && fieldErr.Path != test.path) {
+			t.Errorf("%s: expected field '%s', got %v", test.name, test.path, fieldErr)
+		}
+
+		if fe.Format != "hcl" || fe.Line != test.line || fe.Column != test.col {
+			t.Errorf("%s: expected hcl %d:%d, got %s %d:%d", test.name, test.line, test.col, fe.Format, fe.Line, fe.Column)
+		}
+	}
+}
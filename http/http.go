@@ -0,0 +1,363 @@
+// Package http provides a config provider that fetches a JSON, YAML
+// or TOML document from a URL. Documents are fetched again with
+// If-None-Match so a server that sends an ETag only sends changes,
+// and a copy can be cached on disk to start from when the server
+// can't be reached.
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	nethttp "net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ande980/config/crypt"
+	"github.com/ande980/config/internal/detect"
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/json"
+	"github.com/ande980/config/naming"
+	"github.com/ande980/config/secret"
+	"github.com/ande980/config/toml"
+	"github.com/ande980/config/yaml"
+)
+
+// maxSize is the largest document that will be read, so a server
+// can't exhaust memory by sending an endless body.
+var maxSize int64 = 10 << 20
+
+// Provider is a config provider that fetches a document from a URL
+// and scans it into the specified struct.
+type Provider struct {
+	url       string
+	client    *nethttp.Client
+	timeout   time.Duration
+	token     string
+	user      string
+	password  string
+	basic     bool
+	cache     string
+	format    string
+	resolver  secret.Resolver
+	decrypter crypt.Decrypter
+	naming    naming.Strategy
+
+	mu   sync.Mutex
+	body []byte // The last document fetched
+	kind string // The format of body
+	etag string
+}
+
+// New returns a Provider fetching rawurl with http.DefaultClient
+// and a timeout of 10 seconds.
+func New(rawurl string) *Provider {
+	return &Provider{url: rawurl, timeout: 10 * time.Second}
+}
+
+// WithClient replaces the http.Client used to make requests, such
+// as one configured for mutual TLS.
+func (p *Provider) WithClient(c *nethttp.Client) *Provider {
+	p.client = c
+	return p
+}
+
+// WithTimeout sets how long a request may take, including reading
+// the body. Zero leaves it to the http.Client.
+func (p *Provider) WithTimeout(d time.Duration) *Provider {
+	p.timeout = d
+	return p
+}
+
+// WithBearerToken sends token in an Authorization header.
+func (p *Provider) WithBearerToken(token string) *Provider {
+	p.token = token
+	return p
+}
+
+// WithBasicAuth authenticates with HTTP basic authentication.
+func (p *Provider) WithBasicAuth(user, password string) *Provider {
+	p.user, p.password, p.basic = user, password, true
+	return p
+}
+
+// WithCache keeps a copy of the last document fetched at path.
+// When the server can't be reached, or responds with a server
+// error, the copy is used instead. Its format is taken from the
+// URL, then the extension of path, then the content. Write
+// failures are ignored as the cache is only a fallback.
+func (p *Provider) WithCache(path string) *Provider {
+	p.cache = path
+	return p
+}
+
+// WithFormat sets the format of the document, one of json, jsonc,
+// json5, yaml or toml, rather than going by the Content-Type of
+// the response or the extension of the URL.
+func (p *Provider) WithFormat(format string) *Provider {
+	p.format = format
+	return p
+}
+
+// WithResolver sets the secret.Resolver that string values are
+// passed through as they are decoded. Without one values are stored
+// as they are, so a remote document can't read local files with
+// file:// references unless that's asked for.
+func (p *Provider) WithResolver(r secret.Resolver) *Provider {
+	p.resolver = r
+	return p
+}
+
+// WithDecrypter enables decryption of ENC[...] values in the
+// document before decoding. See the crypt package.
+func (p *Provider) WithDecrypter(d crypt.Decrypter) *Provider {
+	p.decrypter = d
+	return p
+}
+
+// WithNaming sets the strategy that turns the names of fields
+// without a tag into keys, such as naming.Snake for proxy_addr.
+func (p *Provider) WithNaming(s naming.Strategy) *Provider {
+	p.naming = s
+	return p
+}
+
+// Parse implements the config.Provider interface. The document is
+// fetched unless the server reports it unchanged since the last
+// call, in which case the copy already held is decoded again. If
+// the server can't be reached the last copy, or failing that the
+// cache, is used.
+func (p *Provider) Parse(i interface{}) error {
+	p.mu.Lock()
+	_, err := p.fetch(true)
+	buf, format := p.body, p.kind
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if format == "" {
+		format = detect.Format(buf)
+	}
+	return p.decode(buf, format, i)
+}
+
+// Changed fetches the document and reports whether it differs
+// from the one fetched before. Errors are returned as they are
+// rather than falling back to the cache.
+func (p *Provider) Changed() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fetch(false)
+}
+
+// Poll calls Changed every interval until ctx is done, calling fn
+// with nil when the document has changed, so it can be parsed
+// again, or with the error if it couldn't be fetched. It blocks so
+// is usually run in its own goroutine, and returns ctx.Err().
+func (p *Provider) Poll(ctx context.Context, interval time.Duration, fn func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if changed, err := p.Changed(); changed || err != nil {
+				fn(err)
+			}
+		}
+	}
+}
+
+// fetch requests the document, sending the ETag of the last one,
+// and stores it if it changed. With fallback true, failing to
+// reach the server isn't an error if there's a copy of the
+// document held or cached.
+func (p *Provider) fetch(fallback bool) (bool, error) {
+	req, err := nethttp.NewRequest(nethttp.MethodGet, p.url, nil)
+	if err != nil {
+		return false, fmt.Errorf("fetching configuration: %v", err)
+	}
+	req.Header.Set("Accept", "application/json, application/yaml, application/toml, */*;q=0.1")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	if p.basic {
+		req.SetBasicAuth(p.user, p.password)
+	}
+	if p.etag != "" && p.body != nil {
+		req.Header.Set("If-None-Match", p.etag)
+	}
+	if p.timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+
+	client := p.client
+	if client == nil {
+		client = nethttp.DefaultClient
+	}
+
+	unreachable := func(err error) (bool, error) {
+		err = fmt.Errorf("fetching configuration: %v", err)
+		if !fallback {
+			return false, err
+		}
+		if p.body != nil {
+			return false, nil
+		}
+		if p.cache != "" {
+			if buf, cerr := ioutil.ReadFile(p.cache); cerr == nil {
+				p.body, p.kind = buf, p.extFormat()
+				if p.kind == "" {
+					p.kind = extension(filepath.Ext(p.cache))
+				}
+				return true, nil
+			}
+		}
+		return false, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return unreachable(err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == nethttp.StatusNotModified && p.body != nil:
+		return false, nil
+	case resp.StatusCode >= 500:
+		return unreachable(fmt.Errorf("%s: %s", p.url, resp.Status))
+	case resp.StatusCode != nethttp.StatusOK:
+		return false, fmt.Errorf("fetching configuration: %s: %s", p.url, resp.Status)
+	}
+
+	buf, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return unreachable(err)
+	}
+	if int64(len(buf)) > maxSize {
+		return false, fmt.Errorf("fetching configuration: %s: document is larger than %d bytes", p.url, maxSize)
+	}
+
+	changed := p.body == nil || !bytes.Equal(buf, p.body)
+	p.body, p.etag = buf, resp.Header.Get("ETag")
+	p.kind = p.format
+	if p.kind == "" {
+		p.kind = mediaFormat(resp.Header.Get("Content-Type"))
+	}
+	if p.kind == "" {
+		p.kind = p.extFormat()
+	}
+	if changed && p.cache != "" {
+		writeFile(p.cache, buf)
+	}
+	return changed, nil
+}
+
+// extFormat returns the format set with WithFormat, or the one
+// implied by the extension of the URL, if any.
+func (p *Provider) extFormat() string {
+	if p.format != "" {
+		return p.format
+	}
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return ""
+	}
+	return extension(path.Ext(u.Path))
+}
+
+// extension returns the format a file extension implies, if any.
+func extension(ext string) string {
+	switch ext = strings.ToLower(ext); ext {
+	case ".json", ".jsonc", ".json5", ".yaml", ".yml", ".toml":
+		return ext[1:]
+	}
+	return ""
+}
+
+// mediaFormat returns the format of a Content-Type, if it's one
+// that's understood. Types such as text/plain are left to the
+// extension of the URL or the content to decide.
+func mediaFormat(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return "json"
+	case mediaType == "application/yaml", mediaType == "application/x-yaml",
+		mediaType == "text/yaml", mediaType == "text/x-yaml", strings.HasSuffix(mediaType, "+yaml"):
+		return "yaml"
+	case mediaType == "application/toml", mediaType == "text/toml", mediaType == "text/x-toml":
+		return "toml"
+	}
+	return ""
+}
+
+// writeFile replaces the file at name with buf, writing to a
+// temporary file first so a reader never sees half a document.
+func writeFile(name string, buf []byte) {
+	f, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(buf)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// decode scans buf, in format, into i.
+func (p *Provider) decode(buf []byte, format string, i interface{}) error {
+	r := bytes.NewReader(buf)
+	var provider interface{ Parse(interface{}) error }
+	switch format {
+	case "json", "jsonc", "json5":
+		jp := json.WithReader(r).WithResolver(p.resolver).WithDecrypter(p.decrypter).WithNaming(p.naming)
+		if format != "json" {
+			jp.Relaxed()
+		}
+		provider = jp
+	case "yaml", "yml":
+		provider = yaml.WithReader(r).WithResolver(p.resolver).WithDecrypter(p.decrypter).WithNaming(p.naming)
+	case "toml":
+		provider = toml.WithReader(r).WithResolver(p.resolver).WithDecrypter(p.decrypter).WithNaming(p.naming)
+	default:
+		return fmt.Errorf("unable to detect the format of %s", p.url)
+	}
+
+	err := provider.Parse(i)
+	list, ok := err.(errs.Errors)
+	if !ok {
+		list = errs.Errors{err}
+	}
+	for _, e := range list {
+		if fe, ok := e.(*errs.FieldError); ok {
+			e = fe.Err
+		}
+		if fe, ok := e.(*errs.FileError); ok && fe.Path == "" {
+			fe.Path = p.url
+		}
+	}
+	return err
+}
@@ -0,0 +1,301 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	nethttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/secret"
+)
+
+type Config struct {
+	Name    string
+	Port    int
+	Timeout time.Duration
+	Server  Server
+}
+
+type Server struct {
+	Host string
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+	}{
+		{"json content type", "/config", "application/json; charset=utf-8", `{"name": "app", "port": 8080, "server": {"host": "example.com"}}`},
+		{"yaml content type", "/config", "application/x-yaml", "name: app\nport: 8080\nserver:\n  host: example.com\n"},
+		{"toml content type", "/config", "application/toml", "name = \"app\"\nport = 8080\n[server]\nhost = \"example.com\"\n"},
+		{"yaml extension", "/config.yaml", "text/plain", "name: app\nport: 8080\nserver:\n  host: example.com\n"},
+		{"json5 extension", "/config.json5", "", "{name: 'app', port: 8080, server: {host: 'example.com'},}"},
+		{"detected", "/config", "application/octet-stream", "# comment\nname = \"app\"\nport = 8080\n[server]\nhost = \"example.com\"\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				if r.URL.Path != test.path {
+					nethttp.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", test.contentType)
+				w.Write([]byte(test.body))
+			}))
+			defer srv.Close()
+
+			cfg := &Config{}
+			if err := New(srv.URL + test.path).Parse(cfg); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Name != "app" || cfg.Port != 8080 || cfg.Server.Host != "example.com" {
+				t.Errorf("unexpected configuration %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestETag(t *testing.T) {
+	var mu sync.Mutex
+	body, etag, notModified := `{"name": "one"}`, `"1"`, 0
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(nethttp.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	p := New(srv.URL)
+	cfg := &Config{}
+	if err := p.Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if changed, err := p.Changed(); err != nil || changed {
+		t.Errorf("expected no change, got %t, %v", changed, err)
+	}
+
+	cfg = &Config{}
+	if err := p.Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "one" {
+		t.Errorf("expected the unchanged document to be decoded again, got %q", cfg.Name)
+	}
+	mu.Lock()
+	if notModified != 2 {
+		t.Errorf("expected 2 conditional requests answered with 304, got %d", notModified)
+	}
+
+	body, etag = `{"name": "two"}`, `"2"`
+	mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan error)
+	go p.Poll(ctx, 10*time.Millisecond, func(err error) {
+		changes <- err
+		cancel()
+	})
+	select {
+	case err := <-changes:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a change")
+	}
+
+	if err := p.Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "two" {
+		t.Errorf("expected %q, got %q", "two", cfg.Name)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		user, password, ok := r.BasicAuth()
+		if r.Header.Get("Authorization") != "Bearer token" && !(ok && user == "user" && password == "secret") {
+			w.WriteHeader(nethttp.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "app"}`))
+	}))
+	defer srv.Close()
+
+	if err := New(srv.URL).Parse(&Config{}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected an unauthorized error, got %v", err)
+	}
+
+	for _, p := range []*Provider{New(srv.URL).WithBearerToken("token"), New(srv.URL).WithBasicAuth("user", "secret")} {
+		cfg := &Config{}
+		if err := p.Parse(cfg); err != nil {
+			t.Error(err)
+		}
+		if cfg.Name != "app" {
+			t.Errorf("expected %q, got %q", "app", cfg.Name)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	start := time.Now()
+	err := New(srv.URL).WithTimeout(50 * time.Millisecond).Parse(&Config{})
+	if err == nil {
+		t.Fatal("expected a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the request to give up after 50ms, took %s", elapsed)
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config-http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache := filepath.Join(dir, "config.yaml")
+
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write([]byte("name: cached\nport: 80\n"))
+	}))
+	url := srv.URL + "/app"
+
+	if err := New(url).WithCache(cache).Parse(&Config{}); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	if err := New(url).Parse(&Config{}); err == nil {
+		t.Error("expected an error without a cache")
+	}
+
+	cfg := &Config{}
+	if err := New(url).WithCache(cache).Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "cached" || cfg.Port != 80 {
+		t.Errorf("expected the cached configuration, got %+v", cfg)
+	}
+
+	if _, err := New(url).WithCache(cache).Changed(); err == nil {
+		t.Error("expected Changed to report the server unreachable")
+	}
+}
+
+func TestFileError(t *testing.T) {
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{\n  \"port\": \"eighty\"\n}"))
+	}))
+	defer srv.Close()
+
+	err := New(srv.URL).Parse(&Config{})
+	list, ok := err.(errs.Errors)
+	if !ok || len(list) != 1 {
+		t.Fatalf("expected one error, got %v", err)
+	}
+	fe, ok := list[0].(*errs.FieldError).Err.(*errs.FileError)
+	if !ok || fe.Path != srv.URL || fe.Line != 2 {
+		t.Errorf("expected the error to be located in %s on line 2, got %v", srv.URL, list[0])
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	for _, body := range []string{"", "# nothing but a comment\n", "<config/>"} {
+		srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte(body))
+		}))
+
+		err := New(srv.URL).Parse(&Config{})
+		if err == nil || !strings.Contains(err.Error(), "unable to detect the format") {
+			t.Errorf("%q: expected an error detecting the format, got %v", body, err)
+		}
+		srv.Close()
+	}
+}
+
+func TestResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "name")
+	if err := ioutil.WriteFile(path, []byte("local secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "file://` + filepath.ToSlash(path) + `"}`))
+	}))
+	defer srv.Close()
+
+	// A remote document can't read local files by default.
+	cfg := &Config{}
+	if err := New(srv.URL).Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "file://"+filepath.ToSlash(path) {
+		t.Errorf("expected the reference to be left alone, got %q", cfg.Name)
+	}
+
+	cfg = &Config{}
+	if err := New(srv.URL).WithResolver(secret.Default()).Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "local secret" {
+		t.Errorf("expected %q, got %q", "local secret", cfg.Name)
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	size := maxSize
+	defer func() { maxSize = size }()
+	maxSize = 16
+
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "` + strings.Repeat("a", 32) + `"}`))
+	}))
+	defer srv.Close()
+
+	err := New(srv.URL).Parse(&Config{})
+	if err == nil || !strings.Contains(err.Error(), "larger than 16 bytes") {
+		t.Errorf("expected the document to be too large, got %v", err)
+	}
+}
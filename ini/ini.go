@@ -0,0 +1,256 @@
+package ini
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ande980/config/crypt"
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/internal/expand"
+	"github.com/ande980/config/internal/format"
+	"github.com/ande980/config/internal/walk"
+	"github.com/ande980/config/naming"
+	"github.com/ande980/config/secret"
+)
+
+// Provider is a config provider that reads from an INI
+// file or io.Reader and scans into the specified struct.
+// Sections, and dots within section names and keys, map
+// onto nested structs so
+//
+//	[server.tls]
+//	cert = /etc/cert.pem
+//
+// sets Server.TLS.Cert. Names are matched against the ini
+// tag, then the field name without regard to case.
+type Provider struct {
+	r         io.Reader
+	path      string
+	err       error
+	expand    bool
+	strict    bool
+	resolver  secret.Resolver
+	decrypter crypt.Decrypter
+	naming    naming.Strategy
+}
+
+func init() {
+	format.Register("ini", func(r io.Reader, path string, o format.Options) format.Parser {
+		p := WithReader(r)
+		if path != "" {
+			p = WithPath(path)
+		}
+		p.WithResolver(o.Resolver).WithDecrypter(o.Decrypter).WithNaming(o.Naming)
+		if o.Expand {
+			p.ExpandEnv(o.Strict)
+		}
+		return p
+	})
+}
+
+// New is the default way to create an ini Provider. The entire
+// file is read when New is called and a reader created from
+// the buffer. If there is an error reading the file it
+// is stored in Provider and returned during Parse.
+func New() *Provider {
+	filepathNoExt := strings.TrimSuffix(filepath.Base(os.Args[0]), filepath.Ext(os.Args[0]))
+	return WithPath(filepathNoExt + ".ini")
+}
+
+// WithPath allows for a non-standard configuration file to be
+// specified at runtime. If there is an error reading the file it
+// is stored in Provider and returned during Parse.
+func WithPath(path string) *Provider {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return &Provider{r: strings.NewReader("")} // No-op reader
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	p := &Provider{r: bytes.NewReader(buf), path: path}
+	if err != nil {
+		p.err = fmt.Errorf("reading configuration file: %v", err)
+	}
+	return p
+}
+
+// WithReader accepts a reader and returns an ini Provider.
+func WithReader(r io.Reader) *Provider {
+	return &Provider{r: r}
+}
+
+// ExpandEnv enables ${NAME} and ${NAME:-default} placeholders
+// in the file, which are replaced with environmental variables
+// before parsing. $$ is a literal $. An unset variable with no
+// default expands to nothing unless strict is true, in which
+// case Parse returns an error for each one.
+func (p *Provider) ExpandEnv(strict bool) *Provider {
+	p.expand = true
+	p.strict = strict
+	return p
+}
+
+// WithResolver sets the secret.Resolver that values are passed
+// through before they're stored, such as secret.Default() for
+// file:// references. Without one values are stored as they are.
+func (p *Provider) WithResolver(r secret.Resolver) *Provider {
+	p.resolver = r
+	return p
+}
+
+// WithDecrypter enables decryption of values in the ENC[...]
+// form. See the crypt package.
+func (p *Provider) WithDecrypter(d crypt.Decrypter) *Provider {
+	p.decrypter = d
+	return p
+}
+
+// WithNaming sets the strategy that turns the names of fields
+// without a tag into keys, such as naming.Snake for proxy_addr.
+// By default field names are matched without regard to case.
+func (p *Provider) WithNaming(s naming.Strategy) *Provider {
+	p.naming = s
+	return p
+}
+
+// Parse implements the config.Provider interface. Keys that don't
+// match a field are ignored, as they are by the json, toml and
+// yaml providers.
+func (p *Provider) Parse(i interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	buf, err := ioutil.ReadAll(p.r)
+	if err != nil {
+		return fmt.Errorf("reading configuration: %v", err)
+	}
+
+	var m *expand.Map
+	if p.expand {
+		if buf, m, err = expand.File(buf, p.path, "ini", p.strict); err != nil {
+			return err
+		}
+	}
+
+	entries, err := parse(buf)
+	if err != nil {
+		err.(*errs.FileError).Path = p.path
+		return m.Locate(err)
+	}
+
+	var result errs.Errors
+	for _, e := range entries {
+		key := strings.Join(e.keys, ".")
+		var path string
+		value, err := p.value(e.value)
+		if err == nil {
+			path, _, err = walk.Assign(reflect.ValueOf(i), "ini", p.naming, e.keys, value)
+		}
+		if err != nil {
+			result = append(result, &errs.FieldError{
+				Path:   path,
+				Source: "ini",
+				Key:    key,
+				Value:  e.value,
+				Err:    &errs.FileError{Path: p.path, Format: "ini", Line: e.line, Key: key, Err: err},
+			})
+		}
+	}
+	return m.Locate(result.ErrorOrNil())
+}
+
+// value decrypts and resolves s, a value as written in the file.
+func (p *Provider) value(s string) (string, error) {
+	if p.decrypter != nil && crypt.IsEncrypted(s) {
+		var err error
+		if s, err = crypt.DecryptValue(s, p.decrypter); err != nil {
+			return "", err
+		}
+	}
+	if p.resolver != nil {
+		return p.resolver.Resolve(s)
+	}
+	return s, nil
+}
+
+type entry struct {
+	keys  []string
+	value string
+	line  int
+}
+
+// parse reads key = value (or key: value) pairs under [section]
+// headers. Lines starting with ; or # are comments, as is
+// anything after a ; or # preceded by whitespace in an unquoted
+// value. Double quoted values understand Go escapes.
+func parse(buf []byte) ([]entry, error) {
+	var entries []entry
+	var section []string
+	for n, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, &errs.FileError{Format: "ini", Line: n + 1, Err: fmt.Errorf("unterminated section header")}
+			}
+			section = split(line[1 : len(line)-1])
+			continue
+		}
+
+		idx := strings.IndexAny(line, "=:")
+		if idx <= 0 {
+			return nil, &errs.FileError{Format: "ini", Line: n + 1, Err: fmt.Errorf("expected key = value")}
+		}
+
+		value, err := unquote(strings.TrimSpace(line[idx+1:]))
+		if err != nil {
+			return nil, &errs.FileError{Format: "ini", Line: n + 1, Err: err}
+		}
+
+		keys := append(append([]string{}, section...), split(line[:idx])...)
+		entries = append(entries, entry{keys, value, n + 1})
+	}
+	return entries, nil
+}
+
+func split(name string) []string {
+	keys := strings.Split(name, ".")
+	for i := range keys {
+		keys[i] = strings.TrimSpace(keys[i])
+	}
+	return keys
+}
+
+func unquote(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := strings.LastIndex(value, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return strconv.Unquote(value[:end+1])
+	case strings.HasPrefix(value, "'"):
+		end := strings.LastIndex(value, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return value[1:end], nil
+	}
+
+	for _, marker := range []string{" ;", " #", "\t;", "\t#"} {
+		if idx := strings.Index(value, marker); idx >= 0 {
+			value = value[:idx]
+		}
+	}
+	return strings.TrimSpace(value), nil
+}
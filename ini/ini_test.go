@@ -0,0 +1,130 @@
+package ini
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ande980/config/crypt"
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/secret"
+)
+
+type Config struct {
+	A      string `ini:"abcd"`
+	B      bool
+	C      time.Duration
+	Labels map[string]string
+	Server *Server
+}
+
+type Server struct {
+	Addr string
+	TLS  struct {
+		Cert string
+	}
+}
+
+func TestINI(t *testing.T) {
+	cfg := &Config{A: "test"}
+
+	r := strings.NewReader(`; a comment
+abcd = "princes of the universe"
+b: true
+c = 3h ; inline comment
+
+[server]
+addr = :9090
+
+[server.tls]
+cert = '/etc/cert.pem'
+
+[labels]
+team = platform
+`)
+	if err := WithReader(r).Parse(cfg); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if cfg.A != "princes of the universe" {
+		t.Errorf("expected '%s', got '%s'", "princes of the universe", cfg.A)
+	}
+
+	if !cfg.B {
+		t.Errorf("expected %t, got %t", true, cfg.B)
+	}
+
+	if cfg.C != 3*time.Hour {
+		t.Errorf("expected %s, got %s", 3*time.Hour, cfg.C)
+	}
+
+	if cfg.Server == nil || cfg.Server.Addr != ":9090" || cfg.Server.TLS.Cert != "/etc/cert.pem" {
+		t.Errorf("expected server :9090 with /etc/cert.pem, got %+v", cfg.Server)
+	}
+
+	if cfg.Labels["team"] != "platform" {
+		t.Errorf("expected '%s', got '%s'", "platform", cfg.Labels["team"])
+	}
+}
+
+func TestErrors(t *testing.T) {
+	err := WithReader(strings.NewReader("b = true\n[server\n")).Parse(&Config{})
+
+	var fe *errs.FileError
+	if !errors.As(err, &fe) || fe.Line != 2 {
+		t.Errorf("expected an error on line 2, got '%v'", err)
+	}
+
+	err = WithReader(strings.NewReader("c = 1h\n\nb = maybe\n[server]\naddr = :80\n")).Parse(&Config{})
+
+	var fieldErr *errs.FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Path != "B" || fieldErr.Key != "b" {
+		t.Errorf("expected a field error for B, got '%v'", err)
+	}
+
+	if !errors.As(fieldErr, &fe) || fe.Line != 3 {
+		t.Errorf("expected the field error on line 3, got '%v'", fe)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	os.Setenv("INI_TEST_NAME", "brian")
+	defer os.Unsetenv("INI_TEST_NAME")
+
+	key, _ := crypt.GenerateKey()
+	a, _ := crypt.NewAESGCM(key)
+	v, _ := a.Encrypt([]byte("secret://cert"), "str")
+
+	resolver := secret.Schemes{"secret": secret.ResolverFunc(func(s string) (string, error) {
+		return "/etc/" + strings.TrimPrefix(s, "secret://") + ".pem", nil
+	})}
+
+	r := strings.NewReader(`abcd = ${INI_TEST_NAME}
+c = ${INI_TEST_MISSING:-2h}
+[server]
+addr = ${INI_TEST_ADDR}
+[server.tls]
+cert = ` + v.String() + "\n")
+	cfg := &Config{}
+	if err := WithReader(r).ExpandEnv(false).WithDecrypter(a).WithResolver(resolver).Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.A != "brian" || cfg.C != 2*time.Hour {
+		t.Errorf("expected 'brian' and %s, got '%s' and %s", 2*time.Hour, cfg.A, cfg.C)
+	}
+	if cfg.Server == nil || cfg.Server.Addr != "" || cfg.Server.TLS.Cert != "/etc/cert.pem" {
+		t.Errorf("expected an empty address and /etc/cert.pem, got %+v", cfg.Server)
+	}
+
+	r = strings.NewReader("b = true\nabcd = ${INI_TEST_MISSING}\n")
+	err := WithReader(r).ExpandEnv(true).Parse(&Config{})
+
+	var fe *errs.FileError
+	if !errors.As(err, &fe) || fe.Line != 2 {
+		t.Errorf("expected an error on line 2, got '%v'", err)
+	}
+}
@@ -0,0 +1,56 @@
+// Package detect guesses the format of configuration that arrives
+// without a file name to go by.
+package detect
+
+import (
+	"bytes"
+	"regexp"
+)
+
+var (
+	tableRe   = regexp.MustCompile(`^\[\[?\s*[\w"'.-]+(\s*\.\s*[\w"'-]+)*\s*\]\]?\s*(#.*)?$`)
+	assignRe  = regexp.MustCompile(`^[\w"'.-]+\s*=`)
+	mappingRe = regexp.MustCompile(`^("[^"]*"|'[^']*'|[^\s#:{\[][^:#]*):(\s|$)`)
+)
+
+// Format guesses the format of buf from its first significant
+// line: a JSON object, a TOML table header or assignment, or a
+// YAML document marker, mapping or sequence. It returns "jsonc"
+// for JSON preceded by a comment, "unknown" if the line looks like
+// none of them and "" if there's nothing but whitespace and
+// comments.
+func Format(buf []byte) string {
+	buf = bytes.TrimPrefix(buf, []byte("\xef\xbb\xbf"))
+	comment, block := false, false
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		switch {
+		case block:
+			block = !bytes.Contains(line, []byte("*/"))
+			continue
+		case len(line) == 0:
+			continue
+		case bytes.HasPrefix(line, []byte("//")):
+			comment = true
+			continue
+		case bytes.HasPrefix(line, []byte("/*")):
+			comment = true
+			block = !bytes.Contains(line[2:], []byte("*/"))
+			continue
+		case line[0] == '#':
+			continue
+		case line[0] == '{':
+			if comment {
+				return "jsonc"
+			}
+			return "json"
+		case tableRe.Match(line), assignRe.Match(line):
+			return "toml"
+		case bytes.HasPrefix(line, []byte("---")), bytes.HasPrefix(line, []byte("%YAML")),
+			bytes.HasPrefix(line, []byte("- ")), bytes.Equal(line, []byte("-")), mappingRe.Match(line):
+			return "yaml"
+		}
+		return "unknown"
+	}
+	return ""
+}
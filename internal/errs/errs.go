@@ -0,0 +1,229 @@
+// Package errs holds the error types shared between the config
+// package and its providers. They are re-exported by config so
+// this package is an implementation detail.
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FileError describes a failure to decode a configuration file.
+// Line and Column are 1-based and zero when unknown, Key is the
+// dotted path of the offending key when it could be determined.
+type FileError struct {
+	Path   string
+	Format string
+	Line   int
+	Column int
+	Key    string
+	Err    error
+}
+
+// Error implements the error interface in the conventional
+// path:line:column form understood by most editors.
+func (e *FileError) Error() string {
+	var b strings.Builder
+	if e.Path != "" {
+		b.WriteString(e.Path)
+	} else {
+		b.WriteString("<" + e.Format + ">")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ":%d", e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&b, ":%d", e.Column)
+		}
+	}
+	fmt.Fprintf(&b, ": decoding %s file", e.Format)
+	if e.Key != "" {
+		fmt.Fprintf(&b, ": %s", e.Key)
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+	return b.String()
+}
+
+// Unwrap returns the underlying decoder error.
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Position converts a byte offset in buf to a 1-based line
+// and column.
+func Position(buf []byte, offset int64) (line, column int) {
+	if offset > int64(len(buf)) {
+		offset = int64(len(buf))
+	}
+	line, column = 1, 1
+	for _, b := range buf[:offset] {
+		if b == '\n' {
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+	return line, column
+}
+
+// FieldError describes a value that couldn't be stored in a
+// field. Path is the dotted Go path of the field, Source names
+// the provider ("env", "flag", "json" ...), Key is the name the
+// value was given in that source and Value is the raw value.
+type FieldError struct {
+	Path   string
+	Source string
+	Key    string
+	Value  string
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *FieldError) Error() string {
+	// A FileError already says where the value came from.
+	if fe, ok := e.Err.(*FileError); ok && e.Path != "" {
+		return e.Path + ": " + fe.Error()
+	}
+
+	var b strings.Builder
+	if e.Path != "" {
+		b.WriteString(e.Path + ": ")
+	}
+	b.WriteString(e.Source)
+	if e.Key != "" {
+		b.WriteString(" " + e.Key)
+	}
+	if e.Value != "" {
+		fmt.Fprintf(&b, "=%q", e.Value)
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// RuleError describes a value that breaks a validation rule given
+// by a struct tag. Path is the dotted Go path of the field, Rule
+// the rule as written, such as max=10 or url, and Value the value.
+type RuleError struct {
+	Path  string
+	Rule  string
+	Value string
+	Err   error
+}
+
+// Error implements the error interface.
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Path, e.Rule, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// SchemaError describes a value that doesn't match a JSON Schema.
+// Pointer is the JSON pointer of the value, such as /server/port,
+// and Keyword the schema keyword it failed. File, Line and Column
+// locate the value in the configuration file it was read from when
+// it could be found there.
+type SchemaError struct {
+	Pointer string
+	Keyword string
+	Value   string
+	File    string
+	Line    int
+	Column  int
+	Err     error
+}
+
+// Error implements the error interface, starting with the file
+// position when there is one.
+func (e *SchemaError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		if e.Line > 0 {
+			fmt.Fprintf(&b, ":%d", e.Line)
+			if e.Column > 0 {
+				fmt.Fprintf(&b, ":%d", e.Column)
+			}
+		}
+		b.WriteString(": ")
+	}
+	pointer := e.Pointer
+	if pointer == "" {
+		pointer = "/"
+	}
+	fmt.Fprintf(&b, "%s: %s: %v", pointer, e.Keyword, e.Err)
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+// Errors is a list of errors collected while parsing. It is
+// flattened as it is built so it never contains another Errors.
+type Errors []error
+
+// Append adds err to the list, flattening it if it is itself
+// an Errors. Nil errors are ignored.
+func (e Errors) Append(err error) Errors {
+	switch t := err.(type) {
+	case nil:
+		return e
+	case Errors:
+		return append(e, t...)
+	default:
+		return append(e, err)
+	}
+}
+
+// ErrorOrNil returns nil for an empty list so the result can
+// be returned directly as an error.
+func (e Errors) ErrorOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error implements the error interface.
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d errors occurred:", len(e))
+	for _, err := range e {
+		b.WriteString("\n\t* " + err.Error())
+	}
+	return b.String()
+}
+
+// As finds the first error in the list that matches target.
+func (e Errors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Is reports whether any error in the list matches target.
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
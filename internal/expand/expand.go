@@ -0,0 +1,197 @@
+// Package expand implements the ${NAME} and ${NAME:-default}
+// placeholder syntax shared by the file providers.
+package expand
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/ande980/config/internal/errs"
+)
+
+// UndefinedError is returned in strict mode for a placeholder
+// naming a variable that isn't set and has no default. Offset
+// is the position of the placeholder in the input.
+type UndefinedError struct {
+	Name   string
+	Offset int
+}
+
+// Error implements the error interface.
+func (e *UndefinedError) Error() string {
+	return fmt.Sprintf("undefined environment variable %s", e.Name)
+}
+
+// Expand replaces every ${NAME} in buf with the value returned
+// by lookup, and every ${NAME:-default} with the value or the
+// default if the value is unset or empty. $$ is a literal $.
+// Placeholders that don't contain a valid variable name, such
+// as ${server.host}, are left alone for something else to use.
+// An unset variable with no default expands to nothing unless
+// strict is true, in which case an *UndefinedError is returned
+// for each one.
+func Expand(buf []byte, lookup func(string) (string, bool), strict bool) ([]byte, []error) {
+	out, _, errs := expand(buf, lookup, strict)
+	return out, errs
+}
+
+// expand is Expand also returning the offset in buf of each byte
+// of the output. The bytes of an expanded value all come from the
+// start of its placeholder.
+func expand(buf []byte, lookup func(string) (string, bool), strict bool) ([]byte, []int, []error) {
+	var out bytes.Buffer
+	var pos []int
+	var errs []error
+	write := func(s string, offset int) {
+		out.WriteString(s)
+		for j := 0; j < len(s); j++ {
+			pos = append(pos, offset)
+		}
+	}
+	for i := 0; i < len(buf); i++ {
+		if buf[i] != '$' || i == len(buf)-1 {
+			write(string(buf[i]), i)
+			continue
+		}
+
+		if buf[i+1] == '$' {
+			write("$", i)
+			i++
+			continue
+		}
+
+		if buf[i+1] != '{' {
+			write("$", i)
+			continue
+		}
+
+		end := bytes.IndexByte(buf[i:], '}')
+		if end < 0 {
+			write("$", i)
+			continue
+		}
+		end += i
+
+		name, def, hasDef := split(string(buf[i+2 : end]))
+		if !valid(name) {
+			write("$", i)
+			continue
+		}
+
+		val, ok := lookup(name)
+		switch {
+		case ok && val != "":
+		case hasDef:
+			val = def
+		case !ok && strict:
+			errs = append(errs, &UndefinedError{Name: name, Offset: i})
+		}
+		write(val, i)
+		i = end
+	}
+	return out.Bytes(), pos, errs
+}
+
+func split(s string) (name, def string, hasDef bool) {
+	if idx := bytes.Index([]byte(s), []byte(":-")); idx >= 0 {
+		return s[:idx], s[idx+2:], true
+	}
+	return s, "", false
+}
+
+// valid reports whether name is a valid environmental variable
+// name: a letter or underscore followed by letters, digits and
+// underscores.
+func valid(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// File expands a configuration file from the environment. Each
+// undefined variable is reported as a FileError locating the
+// placeholder in the file. The Map returned relates positions in
+// the expanded file to the file as it was written.
+func File(buf []byte, path, format string, strict bool) ([]byte, *Map, error) {
+	out, pos, undefined := expand(buf, os.LookupEnv, strict)
+
+	var result errs.Errors
+	for _, err := range undefined {
+		fe := &errs.FileError{Path: path, Format: format, Err: err}
+		fe.Line, fe.Column = errs.Position(buf, int64(err.(*UndefinedError).Offset))
+		result = append(result, fe)
+	}
+	return out, &Map{orig: buf, out: out, pos: pos}, result.ErrorOrNil()
+}
+
+// Map relates positions in an expanded file to the file as it was
+// written, so that errors found decoding it can be located in the
+// file. A nil Map leaves positions as they are.
+type Map struct {
+	orig []byte
+	out  []byte
+	pos  []int
+}
+
+// Position returns the line and column in the file as it was
+// written of line and column in the expanded file. Positions in an
+// expanded value are reported at its placeholder. A column of zero,
+// meaning it isn't known, stays zero.
+func (m *Map) Position(line, column int) (int, int) {
+	if m == nil || line < 1 {
+		return line, column
+	}
+
+	offset, n := 0, 1
+	for ; n < line && offset < len(m.out); offset++ {
+		if m.out[offset] == '\n' {
+			n++
+		}
+	}
+	for c := 1; c < column && offset < len(m.out) && m.out[offset] != '\n'; c++ {
+		offset++
+	}
+
+	orig := len(m.orig)
+	if offset < len(m.pos) {
+		orig = m.pos[offset]
+	}
+	l, c := errs.Position(m.orig, int64(orig))
+	if column == 0 {
+		c = 0
+	}
+	return l, c
+}
+
+// Locate moves the FileErrors in err, on their own, in a list or
+// wrapped in FieldErrors, to their positions in the file as it was
+// written, and returns err.
+func (m *Map) Locate(err error) error {
+	if m == nil {
+		return err
+	}
+
+	list, ok := err.(errs.Errors)
+	if !ok {
+		list = errs.Errors{err}
+	}
+	for _, e := range list {
+		if fe, ok := e.(*errs.FieldError); ok {
+			e = fe.Err
+		}
+		if fe, ok := e.(*errs.FileError); ok && fe.Line > 0 {
+			fe.Line, fe.Column = m.Position(fe.Line, fe.Column)
+		}
+	}
+	return err
+}
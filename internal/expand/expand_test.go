@@ -0,0 +1,96 @@
+package expand
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	env := map[string]string{
+		"DB_HOST":  "db.local",
+		"DB_EMPTY": "",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{
+			"test1", `host: ${DB_HOST}`, `host: db.local`,
+		},
+		{
+			"test2", `port: ${DB_PORT:-5432}`, `port: 5432`,
+		},
+		{
+			"test3", `host: ${DB_HOST:-localhost}`, `host: db.local`,
+		},
+		{
+			"test4", `empty: ${DB_EMPTY:-default}`, `empty: default`,
+		},
+		{
+			"test5", `price: $$5 and $${DB_HOST}`, `price: $5 and ${DB_HOST}`,
+		},
+		{
+			"test6", `url: ${server.host}:$PORT`, `url: ${server.host}:$PORT`,
+		},
+		{
+			"test7", `missing: ${DB_USER}`, `missing: `,
+		},
+	}
+
+	for _, test := range tests {
+		out, errs := Expand([]byte(test.in), lookup, false)
+		if len(errs) != 0 {
+			t.Errorf("%s: unexpected errors %v", test.name, errs)
+		}
+		if string(out) != test.out {
+			t.Errorf("%s: expected '%s', got '%s'", test.name, test.out, out)
+		}
+	}
+
+	_, errs := Expand([]byte("a: ${DB_USER}\nb: ${DB_PASS:-x}\nc: ${DB_NAME}"), lookup, true)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errs)
+	}
+
+	if e := errs[0].(*UndefinedError); e.Name != "DB_USER" || e.Offset != 3 {
+		t.Errorf("expected DB_USER at 3, got %s at %d", e.Name, e.Offset)
+	}
+}
+
+func TestMap(t *testing.T) {
+	os.Setenv("EXPAND_LONG", "a much longer value")
+	os.Setenv("EXPAND_LINES", "1\n2\n3")
+	defer os.Unsetenv("EXPAND_LONG")
+	defer os.Unsetenv("EXPAND_LINES")
+
+	in := "a: ${EXPAND_LONG}, b: x\nc: ${EXPAND_LINES}\nd: y\n"
+	_, m, err := File([]byte(in), "test", "yaml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line, column int
+		eline, ecol  int
+	}{
+		{1, 1, 1, 1},
+		{1, 10, 1, 4},  // Inside the value of EXPAND_LONG
+		{1, 28, 1, 23}, // x
+		{3, 1, 2, 4},   // The second line of EXPAND_LINES
+		{5, 1, 3, 1},   // d
+		{5, 0, 3, 0},
+	}
+
+	for _, test := range tests {
+		line, column := m.Position(test.line, test.column)
+		if line != test.eline || column != test.ecol {
+			t.Errorf("%d:%d: expected %d:%d, got %d:%d", test.line, test.column, test.eline, test.ecol, line, column)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Package format is the registry of configuration file formats
+// config.Parse understands. Each file provider registers itself, so
+// importing one, such as the hcl provider, makes config.Parse read
+// its files without config depending on it.
+package format
+
+import (
+	"io"
+	"sync"
+
+	"github.com/ande980/config/crypt"
+	"github.com/ande980/config/naming"
+	"github.com/ande980/config/secret"
+)
+
+// Options are the config options that apply to file providers.
+type Options struct {
+	Expand    bool
+	Strict    bool
+	Resolver  secret.Resolver
+	Decrypter crypt.Decrypter
+	Naming    naming.Strategy
+}
+
+// Parser is the config.Provider interface.
+type Parser interface {
+	Parse(interface{}) error
+}
+
+// Func returns a provider for the file at path, or for r if path
+// is empty, with o applied.
+type Func func(r io.Reader, path string, o Options) Parser
+
+var (
+	mu      sync.RWMutex
+	formats = make(map[string]Func)
+)
+
+// Register makes the format called name, which is also its file
+// extension without the dot, available to config.Parse.
+func Register(name string, fn Func) {
+	mu.Lock()
+	defer mu.Unlock()
+	formats[name] = fn
+}
+
+// Lookup returns the Func of the format called name, or nil if it
+// hasn't been registered.
+func Lookup(name string) Func {
+	mu.RLock()
+	defer mu.RUnlock()
+	return formats[name]
+}
@@ -0,0 +1,257 @@
+// Package locate finds where a key's value is written in the raw
+// text of a configuration file. It only understands the common
+// subset of each format: block style YAML mappings, TOML tables
+// and key/value pairs, and any valid JSON.
+package locate
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Span is the position of a scalar value in a file. Start and End
+// are byte offsets, End being exclusive.
+type Span struct {
+	Start int
+	End   int
+}
+
+// JSON finds the scalar value at path in buf.
+func JSON(buf []byte, path []string) (Span, bool) {
+	type frame struct {
+		array     bool
+		key       string
+		expectKey bool
+		index     int
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var stack []*frame
+
+	current := func() []string {
+		keys := make([]string, 0, len(stack))
+		for _, f := range stack {
+			if f.array {
+				keys = append(keys, strconv.Itoa(f.index))
+				continue
+			}
+			keys = append(keys, f.key)
+		}
+		return keys
+	}
+
+	consumed := func() {
+		if len(stack) == 0 {
+			return
+		}
+		top := stack[len(stack)-1]
+		if top.array {
+			top.index++
+			return
+		}
+		top.expectKey = true
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF || err != nil {
+			return Span{}, false
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, &frame{expectKey: true})
+			continue
+		case json.Delim('['):
+			stack = append(stack, &frame{array: true})
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			consumed()
+			continue
+		}
+
+		if len(stack) > 0 {
+			if top := stack[len(stack)-1]; !top.array && top.expectKey {
+				top.key, top.expectKey = tok.(string), false
+				continue
+			}
+		}
+
+		if equal(current(), path) {
+			end := int(dec.InputOffset())
+			return Span{JSONValueStart(buf, int64(end)), end}, true
+		}
+		consumed()
+	}
+}
+
+// JSONValueStart walks back from the end of a scalar JSON value
+// to find where it began, as encoding/json only reports offsets
+// after a value has been consumed.
+func JSONValueStart(buf []byte, end int64) int {
+	if end > int64(len(buf)) {
+		end = int64(len(buf))
+	}
+	i := int(end) - 1
+	if i < 0 {
+		return 0
+	}
+	if buf[i] == '"' {
+		for i--; i > 0; i-- {
+			if buf[i] == '"' && buf[i-1] != '\\' {
+				return i
+			}
+		}
+		return 0
+	}
+	for ; i > 0; i-- {
+		if strings.IndexByte(" \t\r\n:,[{", buf[i-1]) >= 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// YAML finds the scalar value at path in buf by following the
+// indentation of block mappings.
+func YAML(buf []byte, path []string) (Span, bool) {
+	type entry struct {
+		indent int
+		key    string
+	}
+
+	var stack []entry
+	offset := 0
+	for _, line := range strings.SplitAfter(string(buf), "\n") {
+		start := offset
+		offset += len(line)
+
+		key, indent, value := yamlKey(strings.TrimRight(line, "\r\n"))
+		if key == "" {
+			continue
+		}
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, entry{indent, key})
+
+		keys := make([]string, len(stack))
+		for i, e := range stack {
+			keys[i] = e.key
+		}
+		if !equal(keys, path) || value < 0 {
+			continue
+		}
+
+		end := valueEnd(line, value)
+		if end <= value {
+			return Span{}, false
+		}
+		return Span{start + value, start + end}, true
+	}
+	return Span{}, false
+}
+
+// yamlKey splits a line into the key it defines, its indentation
+// and the offset of its value, or -1 if the value is on the
+// following lines.
+func yamlKey(line string) (string, int, int) {
+	trimmed := strings.TrimLeft(line, " ")
+	indent := len(line) - len(trimmed)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "- ") {
+		return "", indent, -1
+	}
+
+	idx := strings.Index(trimmed, ":")
+	if idx <= 0 || (idx+1 < len(trimmed) && trimmed[idx+1] != ' ') {
+		return "", indent, -1
+	}
+
+	key := strings.Trim(trimmed[:idx], `"'`)
+	rest := trimmed[idx+1:]
+	value := strings.TrimLeft(rest, " ")
+	if value == "" || strings.HasPrefix(value, "#") {
+		return key, indent, -1
+	}
+	return key, indent, len(line) - len(value)
+}
+
+// TOML finds the scalar value at path in buf by tracking the
+// table headers above each key.
+func TOML(buf []byte, path []string) (Span, bool) {
+	var table []string
+	offset := 0
+	for _, line := range strings.SplitAfter(string(buf), "\n") {
+		start := offset
+		offset += len(line)
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			table = strings.Split(strings.Trim(trimmed, "[] "), ".")
+			for i := range table {
+				table[i] = strings.Trim(strings.TrimSpace(table[i]), `"'`)
+			}
+			continue
+		}
+
+		idx := strings.Index(line, "=")
+		if idx <= 0 || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		key := strings.Trim(strings.TrimSpace(line[:idx]), `"'`)
+		if !equal(append(append([]string{}, table...), key), path) {
+			continue
+		}
+
+		value := idx + 1
+		for value < len(line) && (line[value] == ' ' || line[value] == '\t') {
+			value++
+		}
+		end := valueEnd(line, value)
+		if end <= value {
+			return Span{}, false
+		}
+		return Span{start + value, start + end}, true
+	}
+	return Span{}, false
+}
+
+// valueEnd finds the end of the value starting at start in line,
+// excluding any trailing comment and whitespace.
+func valueEnd(line string, start int) int {
+	end := len(strings.TrimRight(line, "\r\n"))
+	var quote byte
+	for i := start; i < end; i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && i > start && (line[i-1] == ' ' || line[i-1] == '\t'):
+			end = i
+		}
+	}
+	return len(strings.TrimRight(line[:end], " \t"))
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
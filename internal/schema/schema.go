@@ -0,0 +1,536 @@
+// Package schema validates a tree of decoded values against a JSON
+// Schema. It understands the assertions of draft 2020-12 that make
+// sense for configuration: type, enum and const, numeric and length
+// bounds, pattern, a handful of formats, properties, items, the
+// allOf, anyOf, oneOf and not combinators and $ref within the
+// document. Other keywords are ignored.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Error is a value that doesn't match the schema.
+type Error struct {
+	Keys    []string // Keys leading to the value in the tree
+	Keyword string   // The schema keyword that failed
+	Value   string   // The value, if it's a scalar
+	Err     error
+}
+
+// Pointer returns the JSON pointer of the value, such as
+// /server/port.
+func (e *Error) Pointer() string {
+	var b strings.Builder
+	for _, key := range e.Keys {
+		key = strings.Replace(key, "~", "~0", -1)
+		key = strings.Replace(key, "/", "~1", -1)
+		b.WriteString("/" + key)
+	}
+	return b.String()
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Pointer(), e.Keyword, e.Err)
+}
+
+// Parse decodes a JSON Schema document.
+func Parse(buf []byte) (interface{}, error) {
+	var s interface{}
+	if err := json.Unmarshal(buf, &s); err != nil {
+		return nil, fmt.Errorf("decoding schema: %v", err)
+	}
+	switch s.(type) {
+	case map[string]interface{}, bool:
+		return s, nil
+	}
+	return nil, fmt.Errorf("decoding schema: not an object")
+}
+
+// Validate checks instance, a tree of maps with string keys,
+// slices and scalars, against s, a schema returned by Parse.
+// Every failure is returned rather than stopping at the first.
+func Validate(s, instance interface{}) []*Error {
+	v := &validator{root: s}
+	v.validate(s, instance, nil, 0)
+	return v.errs
+}
+
+// maxDepth stops a $ref that refers to itself forever.
+const maxDepth = 64
+
+type validator struct {
+	root interface{}
+	errs []*Error
+}
+
+func (v *validator) fail(keys []string, keyword string, node interface{}, format string, args ...interface{}) {
+	e := &Error{Keys: keys, Keyword: keyword, Err: fmt.Errorf(format, args...)}
+	if scalar(node) {
+		e.Value = fmt.Sprint(node)
+	}
+	v.errs = append(v.errs, e)
+}
+
+// valid reports whether node matches s without recording errors.
+func (v *validator) valid(s, node interface{}, keys []string, depth int) bool {
+	sub := &validator{root: v.root}
+	sub.validate(s, node, keys, depth)
+	return len(sub.errs) == 0
+}
+
+func (v *validator) validate(s, node interface{}, keys []string, depth int) {
+	if depth > maxDepth {
+		v.fail(keys, "$ref", node, "schema is nested too deeply")
+		return
+	}
+
+	switch s := s.(type) {
+	case bool:
+		if !s {
+			v.fail(keys, "false", node, "no value is allowed")
+		}
+		return
+	case map[string]interface{}:
+		v.keywords(s, node, keys, depth)
+	}
+}
+
+func (v *validator) keywords(s map[string]interface{}, node interface{}, keys []string, depth int) {
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := v.resolve(ref)
+		if err != nil {
+			v.fail(keys, "$ref", node, "%v", err)
+		} else {
+			v.validate(target, node, keys, depth+1)
+		}
+	}
+
+	if t, ok := s["type"]; ok && !v.hasType(t, node) {
+		v.fail(keys, "type", node, "%s is not %s", describe(node), types(t))
+		return
+	}
+
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if equal(e, node) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(keys, "enum", node, "%s is not one of %s", show(node), list(enum))
+		}
+	}
+	if c, ok := s["const"]; ok && !equal(c, node) {
+		v.fail(keys, "const", node, "%s is not %s", show(node), show(c))
+	}
+
+	switch n := node.(type) {
+	case string:
+		v.string(s, n, keys)
+	case map[string]interface{}:
+		v.object(s, n, keys, depth)
+	case []interface{}:
+		v.array(s, n, keys, depth)
+	default:
+		if f, ok := number(node); ok {
+			v.number(s, f, node, keys)
+		}
+	}
+
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			v.validate(sub, node, keys, depth+1)
+		}
+	}
+	if any, ok := s["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range any {
+			if v.valid(sub, node, keys, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(keys, "anyOf", node, "%s doesn't match any of the schemas", show(node))
+		}
+	}
+	if one, ok := s["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, sub := range one {
+			if v.valid(sub, node, keys, depth+1) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.fail(keys, "oneOf", node, "%s matches %d of the schemas, not 1", show(node), matched)
+		}
+	}
+	if not, ok := s["not"]; ok && v.valid(not, node, keys, depth+1) {
+		v.fail(keys, "not", node, "%s matches a schema it mustn't", show(node))
+	}
+}
+
+func (v *validator) number(s map[string]interface{}, f float64, node interface{}, keys []string) {
+	if min, ok := number(s["minimum"]); ok && f < min {
+		v.fail(keys, "minimum", node, "%s is less than %s", show(node), show(s["minimum"]))
+	}
+	if max, ok := number(s["maximum"]); ok && f > max {
+		v.fail(keys, "maximum", node, "%s is more than %s", show(node), show(s["maximum"]))
+	}
+	if min, ok := number(s["exclusiveMinimum"]); ok && f <= min {
+		v.fail(keys, "exclusiveMinimum", node, "%s is not more than %s", show(node), show(s["exclusiveMinimum"]))
+	}
+	if max, ok := number(s["exclusiveMaximum"]); ok && f >= max {
+		v.fail(keys, "exclusiveMaximum", node, "%s is not less than %s", show(node), show(s["exclusiveMaximum"]))
+	}
+	if m, ok := number(s["multipleOf"]); ok && m > 0 {
+		if q := f / m; q != math.Trunc(q) {
+			v.fail(keys, "multipleOf", node, "%s is not a multiple of %s", show(node), show(s["multipleOf"]))
+		}
+	}
+}
+
+func (v *validator) string(s map[string]interface{}, str string, keys []string) {
+	n := float64(utf8.RuneCountInString(str))
+	if min, ok := number(s["minLength"]); ok && n < min {
+		v.fail(keys, "minLength", str, "length is %v, less than %v", n, min)
+	}
+	if max, ok := number(s["maxLength"]); ok && n > max {
+		v.fail(keys, "maxLength", str, "length is %v, more than %v", n, max)
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		switch {
+		case err != nil:
+			v.fail(keys, "pattern", str, "invalid pattern: %v", err)
+		case !re.MatchString(str):
+			v.fail(keys, "pattern", str, "%q does not match %s", str, pattern)
+		}
+	}
+	if format, ok := s["format"].(string); ok {
+		if err := checkFormat(format, str); err != nil {
+			v.fail(keys, "format", str, "%v", err)
+		}
+	}
+}
+
+func (v *validator) array(s map[string]interface{}, arr []interface{}, keys []string, depth int) {
+	n := float64(len(arr))
+	if min, ok := number(s["minItems"]); ok && n < min {
+		v.fail(keys, "minItems", arr, "%v items, less than %v", n, min)
+	}
+	if max, ok := number(s["maxItems"]); ok && n > max {
+		v.fail(keys, "maxItems", arr, "%v items, more than %v", n, max)
+	}
+	if unique, _ := s["uniqueItems"].(bool); unique {
+	outer:
+		for i := range arr {
+			for j := 0; j < i; j++ {
+				if equal(arr[i], arr[j]) {
+					v.fail(add(keys, strconv.Itoa(i)), "uniqueItems", arr[i], "%s is repeated", show(arr[i]))
+					break outer
+				}
+			}
+		}
+	}
+
+	prefix, _ := s["prefixItems"].([]interface{})
+	for i, elem := range arr {
+		elemKeys := add(keys, strconv.Itoa(i))
+		if i < len(prefix) {
+			v.validate(prefix[i], elem, elemKeys, depth+1)
+		} else if items, ok := s["items"]; ok {
+			v.validate(items, elem, elemKeys, depth+1)
+		}
+	}
+}
+
+func (v *validator) object(s map[string]interface{}, obj map[string]interface{}, keys []string, depth int) {
+	n := float64(len(obj))
+	if min, ok := number(s["minProperties"]); ok && n < min {
+		v.fail(keys, "minProperties", obj, "%v properties, less than %v", n, min)
+	}
+	if max, ok := number(s["maxProperties"]); ok && n > max {
+		v.fail(keys, "maxProperties", obj, "%v properties, more than %v", n, max)
+	}
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := obj[name]; !ok {
+				v.fail(add(keys, name), "required", nil, "a value is required")
+			}
+		}
+	}
+
+	properties, _ := s["properties"].(map[string]interface{})
+	patterns, _ := s["patternProperties"].(map[string]interface{})
+	for _, key := range sortedKeys(obj) {
+		elemKeys := add(keys, key)
+		matched := false
+		if sub, ok := properties[key]; ok {
+			v.validate(sub, obj[key], elemKeys, depth+1)
+			matched = true
+		}
+		for _, pattern := range sortedKeys(patterns) {
+			if re, err := regexp.Compile(pattern); err == nil && re.MatchString(key) {
+				v.validate(patterns[pattern], obj[key], elemKeys, depth+1)
+				matched = true
+			}
+		}
+		if additional, ok := s["additionalProperties"]; ok && !matched {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				v.fail(elemKeys, "additionalProperties", obj[key], "%s is not allowed", key)
+				continue
+			}
+			v.validate(additional, obj[key], elemKeys, depth+1)
+		}
+	}
+}
+
+// resolve finds the schema referred to by ref, which must be a
+// JSON pointer within the document such as #/$defs/server.
+func (v *validator) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("only references within the schema are supported, not %s", ref)
+	}
+	node := v.root
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer == "" {
+		return node, nil
+	}
+	for _, part := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		part, _ = url.PathUnescape(part)
+		part = strings.Replace(part, "~1", "/", -1)
+		part = strings.Replace(part, "~0", "~", -1)
+		switch n := node.(type) {
+		case map[string]interface{}:
+			node = n[part]
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, fmt.Errorf("%s not found", ref)
+			}
+			node = n[i]
+		default:
+			node = nil
+		}
+		if node == nil {
+			return nil, fmt.Errorf("%s not found", ref)
+		}
+	}
+	return node, nil
+}
+
+func (v *validator) hasType(t, node interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return is(t, node)
+	case []interface{}:
+		for _, name := range t {
+			if s, ok := name.(string); ok && is(s, node) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// is reports whether node is of the JSON type name.
+func is(name string, node interface{}) bool {
+	switch name {
+	case "null":
+		return node == nil
+	case "boolean":
+		_, ok := node.(bool)
+		return ok
+	case "string":
+		_, ok := node.(string)
+		return ok
+	case "object":
+		_, ok := node.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := node.([]interface{})
+		return ok
+	case "number":
+		_, ok := number(node)
+		return ok
+	case "integer":
+		f, ok := number(node)
+		return ok && f == math.Trunc(f)
+	}
+	return false
+}
+
+func checkFormat(format, s string) error {
+	switch format {
+	case "uri":
+		u, err := url.Parse(s)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" {
+			return fmt.Errorf("%q is not an absolute URI", s)
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			return fmt.Errorf("%q is not a date-time", s)
+		}
+	case "email":
+		if _, err := mail.ParseAddress(s); err != nil {
+			return fmt.Errorf("%q is not an email address", s)
+		}
+	case "ipv4":
+		if ip := net.ParseIP(s); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("%q is not an IPv4 address", s)
+		}
+	case "ipv6":
+		if ip := net.ParseIP(s); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("%q is not an IPv6 address", s)
+		}
+	}
+	return nil
+}
+
+// number returns node as a float64 if it's any kind of number.
+func number(node interface{}) (float64, bool) {
+	switch n := node.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// equal compares two values as JSON does, so numbers of different
+// Go types are equal if their values are.
+func equal(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	switch a := a.(type) {
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k := range a {
+			if !equal(a[k], b[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func scalar(node interface{}) bool {
+	switch node.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
+
+func describe(node interface{}) string {
+	switch node.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if _, ok := number(node); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", node)
+}
+
+func types(t interface{}) string {
+	if list, ok := t.([]interface{}); ok {
+		var names []string
+		for _, name := range list {
+			names = append(names, fmt.Sprint(name))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+// show formats a value as it would be written in JSON.
+func show(node interface{}) string {
+	if f, ok := number(node); ok {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	buf, err := json.Marshal(node)
+	if err != nil {
+		return fmt.Sprint(node)
+	}
+	return string(buf)
+}
+
+func list(values []interface{}) string {
+	shown := make([]string, len(values))
+	for i, value := range values {
+		shown[i] = show(value)
+	}
+	return strings.Join(shown, ", ")
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// add returns a copy of s with elem appended.
+func add(s []string, elem string) []string {
+	return append(s[:len(s):len(s)], elem)
+}
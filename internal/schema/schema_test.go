@@ -0,0 +1,120 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		instance string
+		errs     string
+	}{
+		{
+			"type", `{"type": "integer"}`, `1.5`, "type",
+		},
+		{
+			"types", `{"type": ["string", "null"]}`, `null`, "",
+		},
+		{
+			"enum", `{"enum": ["http", "https"]}`, `"ftp"`, "enum",
+		},
+		{
+			"const", `{"const": 1}`, `1.0`, "",
+		},
+		{
+			"bounds", `{"properties": {"port": {"minimum": 1, "maximum": 65535}, "ratio": {"exclusiveMaximum": 1}}}`,
+			`{"port": 70000, "ratio": 1}`, "maximum /port, exclusiveMaximum /ratio",
+		},
+		{
+			"multipleOf", `{"multipleOf": 0.5}`, `1.25`, "multipleOf",
+		},
+		{
+			"length", `{"minLength": 2, "maxLength": 3}`, `"é"`, "minLength",
+		},
+		{
+			"pattern", `{"pattern": "^[a-z]+$"}`, `"EN"`, "pattern",
+		},
+		{
+			"format", `{"properties": {"url": {"format": "uri"}, "ip": {"format": "ipv4"}, "at": {"format": "date-time"}}}`,
+			`{"url": "example.com", "ip": "::1", "at": "2006-01-02T15:04:05Z"}`, "format /ip, format /url",
+		},
+		{
+			"required", `{"required": ["host", "port"]}`, `{"port": 80}`, "required /host",
+		},
+		{
+			"additionalProperties", `{"properties": {"a": true}, "patternProperties": {"^x-": true}, "additionalProperties": false}`,
+			`{"a": 1, "x-b": 2, "c": 3}`, "additionalProperties /c",
+		},
+		{
+			"items", `{"prefixItems": [{"type": "string"}], "items": {"type": "integer"}, "maxItems": 2, "uniqueItems": true}`,
+			`["a", "b", 1]`, "maxItems, type /1",
+		},
+		{
+			"uniqueItems", `{"uniqueItems": true}`, `[1, 2, 1.0]`, "uniqueItems /2",
+		},
+		{
+			"anyOf", `{"anyOf": [{"type": "string"}, {"minimum": 10}]}`, `5`, "anyOf",
+		},
+		{
+			"oneOf", `{"oneOf": [{"type": "integer"}, {"minimum": 0}]}`, `5`, "oneOf",
+		},
+		{
+			"not", `{"not": {"type": "null"}}`, `null`, "not",
+		},
+		{
+			"ref", `{"properties": {"server": {"$ref": "#/$defs/server"}}, "$defs": {"server": {"required": ["addr"]}}}`,
+			`{"server": {}}`, "required /server/addr",
+		},
+		{
+			"escaped keys", `{"properties": {"a/b": {"properties": {"c~d": {"type": "string"}}}}}`,
+			`{"a/b": {"c~d": 1}}`, "type /a~1b/c~0d",
+		},
+		{
+			"recursive ref", `{"$ref": "#"}`, `1`, "$ref",
+		},
+	}
+
+	for _, test := range tests {
+		s, err := Parse([]byte(test.schema))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		var instance interface{}
+		if err := json.Unmarshal([]byte(test.instance), &instance); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		var got []string
+		for _, e := range Validate(s, instance) {
+			got = append(got, strings.TrimSpace(e.Keyword+" "+e.Pointer()))
+		}
+		if strings.Join(got, ", ") != test.errs {
+			t.Errorf("%s: expected '%s', got '%s'", test.name, test.errs, strings.Join(got, ", "))
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		ok   bool
+	}{
+		{"object", `{"type": "string"}`, true},
+		{"boolean", `true`, true},
+		{"array", `[]`, false},
+		{"invalid", `{"type":`, false},
+	}
+
+	for _, test := range tests {
+		if _, err := Parse([]byte(test.in)); (err == nil) != test.ok {
+			t.Errorf("%s: expected ok to be %t, got %v", test.name, test.ok, err)
+		}
+	}
+}
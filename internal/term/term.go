@@ -0,0 +1,4 @@
+// Package term turns off echo on a terminal so secrets can be read
+// without being shown. It's only implemented on Unix systems, where
+// it uses the termios ioctls directly to avoid a dependency.
+package term
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package term
+
+import "errors"
+
+// IsTerminal reports whether fd refers to a terminal. It always
+// returns false where terminals aren't supported.
+func IsTerminal(fd uintptr) bool {
+	return false
+}
+
+// NoEcho isn't supported on this system.
+func NoEcho(fd uintptr) (restore func(), err error) {
+	return nil, errors.New("turning off echo is not supported")
+}
@@ -0,0 +1,534 @@
+package walk
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ande980/config/naming"
+)
+
+// Binder stores a tree of decoded values, as produced by decoding
+// a file into an interface{}, in a struct. Keys are matched to
+// fields by Key, exactly or failing that without regard to case,
+// so the config tag works the same way for every format.
+type Binder struct {
+	// Tag is the format's own struct tag, such as json.
+	Tag string
+	// Naming converts the names of fields without a tag into
+	// keys. Field names are used as they are if it's nil.
+	Naming naming.Strategy
+	// Loose allows any scalar to be stored in a string field, as
+	// YAML decoders allow.
+	Loose bool
+	// Blocks merges a list of maps into a single struct or map,
+	// which is how HCL decodes repeated and labelled blocks.
+	Blocks bool
+	// Custom stores node in ptr itself if ptr has its own method
+	// for decoding the format, and reports whether it did.
+	Custom func(node, ptr interface{}) (bool, error)
+	// Resolve, if set, is passed every string stored in a string
+	// field and returns the value to store in its place.
+	Resolve func(string) (string, error)
+	// JSON follows encoding/json where it does more than store
+	// values: the string option of the tag, which quotes a scalar
+	// in a string, []byte fields, which hold base64, and numbers
+	// stored in an interface{}, which are float64.
+	JSON bool
+}
+
+// BindError is a value in the tree that couldn't be stored.
+type BindError struct {
+	Keys  []string // Keys leading to the value in the tree
+	Path  string   // Dotted Go path of the field
+	Value string   // The value, if it's a scalar
+	Err   error
+}
+
+// Error implements the error interface.
+func (e *BindError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+// Bind stores tree in v, a pointer to a struct. Keys with no
+// matching field are ignored. Every value that couldn't be
+// stored is returned rather than stopping at the first.
+func (b *Binder) Bind(v reflect.Value, tree interface{}) []*BindError {
+	var result []*BindError
+	b.bind(v, tree, nil, nil, &result)
+	return result
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func (b *Binder) bind(v reflect.Value, node interface{}, keys, path []string, result *[]*BindError) {
+	if node == nil {
+		return
+	}
+
+	fail := func(err error) {
+		e := &BindError{Keys: keys, Path: strings.Join(path, "."), Err: err}
+		if scalar(node) {
+			e.Value = fmt.Sprint(node)
+		}
+		*result = append(*result, e)
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if !v.CanSet() {
+				return
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		b.bind(v.Elem(), node, keys, path, result)
+		return
+	}
+
+	if s, ok := node.(string); ok && b.Resolve != nil && v.Kind() == reflect.String {
+		resolved, err := b.Resolve(s)
+		if err != nil {
+			fail(err)
+			return
+		}
+		node = resolved
+	}
+
+	if b.Custom != nil {
+		if ok, err := b.Custom(node, v.Addr().Interface()); ok {
+			if err != nil {
+				fail(err)
+			}
+			return
+		}
+	}
+
+	if s, ok := node.(string); ok {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if err := u.UnmarshalText([]byte(s)); err != nil {
+				fail(err)
+			}
+			return
+		}
+	}
+
+	if rv := reflect.ValueOf(node); rv.Type() == v.Type() && v.Kind() != reflect.Map && v.Kind() != reflect.Slice {
+		v.Set(rv)
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			fail(fmt.Errorf("cannot use %s as %s", describe(node), v.Type()))
+			return
+		}
+		node = Normalize(node)
+		if b.JSON {
+			var err error
+			if node, err = floats(node); err != nil {
+				fail(err)
+				return
+			}
+		}
+		v.Set(reflect.ValueOf(node))
+	case reflect.Struct:
+		maps, ok := b.maps(node)
+		if !ok {
+			fail(fmt.Errorf("cannot use %s as %s", describe(node), v.Type()))
+			return
+		}
+		for _, m := range maps {
+			b.fields(v, m, keys, path, result)
+		}
+	case reflect.Map:
+		maps, ok := b.maps(node)
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			fail(fmt.Errorf("cannot use %s as %s", describe(node), v.Type()))
+			return
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for _, m := range maps {
+			for _, k := range sortedKeys(m) {
+				key := reflect.ValueOf(k).Convert(v.Type().Key())
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if existing := v.MapIndex(key); existing.IsValid() {
+					elem.Set(existing)
+				}
+				b.bind(elem, m[k], add(keys, k), add(path, k), result)
+				v.SetMapIndex(key, elem)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if s, ok := node.(string); ok && b.JSON && v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			buf, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				fail(err)
+				return
+			}
+			v.SetBytes(buf)
+			return
+		}
+		rv := reflect.ValueOf(node)
+		if rv.Kind() != reflect.Slice {
+			fail(fmt.Errorf("cannot use %s as %s", describe(node), v.Type()))
+			return
+		}
+		n := rv.Len()
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), n, n))
+		} else if n > v.Len() {
+			n = v.Len()
+		}
+		for i := 0; i < n; i++ {
+			idx := strconv.Itoa(i)
+			b.bind(v.Index(i), rv.Index(i).Interface(), add(keys, idx), add(path, idx), result)
+		}
+	case reflect.String:
+		switch {
+		case reflect.TypeOf(node).Kind() == reflect.String && !isNumber(node):
+			v.SetString(reflect.ValueOf(node).String())
+		case b.Loose && scalar(node):
+			v.SetString(fmt.Sprint(node))
+		default:
+			fail(fmt.Errorf("cannot use %s as %s", describe(node), v.Type()))
+		}
+	case reflect.Bool:
+		bv, ok := node.(bool)
+		if !ok {
+			fail(fmt.Errorf("cannot use %s as %s", describe(node), v.Type()))
+			return
+		}
+		v.SetBool(bv)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s, ok := node.(string); ok && v.Type() == durationType {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				fail(fmt.Errorf("parsing duration: %v", err))
+				return
+			}
+			v.SetInt(int64(d))
+			return
+		}
+		n, ok := toInt(node)
+		switch {
+		case !ok:
+			fail(fmt.Errorf("cannot use %s as %s", describe(node), v.Type()))
+		case v.OverflowInt(n):
+			fail(fmt.Errorf("%d overflows %s", n, v.Type()))
+		default:
+			v.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := toUint(node)
+		switch {
+		case !ok:
+			fail(fmt.Errorf("cannot use %s as %s", describe(node), v.Type()))
+		case v.OverflowUint(n):
+			fail(fmt.Errorf("%d overflows %s", n, v.Type()))
+		default:
+			v.SetUint(n)
+		}
+	case reflect.Float32, reflect.Float64:
+		f, ok := toFloat(node)
+		switch {
+		case !ok:
+			fail(fmt.Errorf("cannot use %s as %s", describe(node), v.Type()))
+		case v.OverflowFloat(f):
+			fail(fmt.Errorf("%g overflows %s", f, v.Type()))
+		default:
+			v.SetFloat(f)
+		}
+	default:
+		fail(fmt.Errorf("cannot use %s as %s", describe(node), v.Type()))
+	}
+}
+
+// fields stores the values in m in the fields of v, a struct.
+func (b *Binder) fields(v reflect.Value, m map[string]interface{}, keys, path []string, result *[]*BindError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// The exported fields of an unexported embedded
+			// struct are promoted and can still be set.
+			if f.Anonymous && f.Type.Kind() == reflect.Struct && Flatten(f, b.Tag) {
+				b.fields(v.Field(i), m, keys, path, result)
+			}
+			continue
+		}
+
+		if Flatten(f, b.Tag) {
+			b.bind(v.Field(i), m, keys, path, result)
+			continue
+		}
+
+		name, ok := Key(f, b.Tag, b.Naming)
+		if !ok {
+			continue
+		}
+		key, ok := lookup(m, name)
+		if !ok {
+			continue
+		}
+
+		node := m[key]
+		if b.JSON && quoted(f, b.Tag) {
+			var err error
+			if node, err = unquote(node); err != nil {
+				value := ""
+				if scalar(m[key]) {
+					value = fmt.Sprint(m[key])
+				}
+				*result = append(*result, &BindError{Keys: add(keys, key), Path: strings.Join(add(path, f.Name), "."), Value: value, Err: err})
+				continue
+			}
+		}
+		b.bind(v.Field(i), node, add(keys, key), add(path, f.Name), result)
+	}
+}
+
+// quoted reports whether f has the string option in its tag and
+// a type it applies to, as encoding/json decides.
+func quoted(f reflect.StructField, tag string) bool {
+	t := f.Type
+	if t.Kind() == reflect.Ptr && t.Name() == "" {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+	default:
+		return false
+	}
+
+	for _, opt := range strings.Split(f.Tag.Get(tag), ",")[1:] {
+		if opt == "string" {
+			return true
+		}
+	}
+	return false
+}
+
+// unquote decodes the JSON scalar held in node, a string.
+func unquote(node interface{}) (interface{}, error) {
+	s, ok := node.(string)
+	if !ok {
+		if node == nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot use %s as a quoted value", describe(node))
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil || v != nil && !scalar(v) || dec.More() {
+		return nil, fmt.Errorf("invalid quoted value %q", s)
+	}
+	return v, nil
+}
+
+// floats converts every json.Number in node, a tree copied by
+// Normalize, to a float64 in place, as encoding/json stores numbers
+// in an interface{}.
+func floats(node interface{}) (interface{}, error) {
+	switch n := node.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("%s overflows float64", n)
+		}
+		return f, nil
+	case map[string]interface{}:
+		for k, v := range n {
+			f, err := floats(v)
+			if err != nil {
+				return nil, err
+			}
+			n[k] = f
+		}
+	case []interface{}:
+		for i, v := range n {
+			f, err := floats(v)
+			if err != nil {
+				return nil, err
+			}
+			n[i] = f
+		}
+	}
+	return node, nil
+}
+
+// maps returns node as one or more maps with string keys.
+func (b *Binder) maps(node interface{}) ([]map[string]interface{}, bool) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{n}, true
+	case map[interface{}]interface{}:
+		return []map[string]interface{}{stringKeys(n)}, true
+	case []map[string]interface{}:
+		return n, b.Blocks
+	case []interface{}:
+		if !b.Blocks {
+			return nil, false
+		}
+		var maps []map[string]interface{}
+		for _, elem := range n {
+			m, ok := b.maps(elem)
+			if !ok {
+				return nil, false
+			}
+			maps = append(maps, m...)
+		}
+		return maps, true
+	}
+	return nil, false
+}
+
+// lookup finds the key in m naming a field, exactly or failing
+// that without regard to case.
+func lookup(m map[string]interface{}, name string) (string, bool) {
+	if _, ok := m[name]; ok {
+		return name, true
+	}
+	for _, key := range sortedKeys(m) {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Normalize converts the maps in a decoded tree to maps with
+// string keys, as some YAML decoders produce interface{} keys.
+func Normalize(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[interface{}]interface{}:
+		return Normalize(stringKeys(n))
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(n))
+		for k, v := range n {
+			m[k] = Normalize(v)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(n))
+		for i, v := range n {
+			s[i] = Normalize(v)
+		}
+		return s
+	}
+	return node
+}
+
+func stringKeys(n map[interface{}]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(n))
+	for k, v := range n {
+		m[fmt.Sprint(k)] = v
+	}
+	return m
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// add returns a copy of s with elem appended so slices passed
+// down the tree are never shared.
+func add(s []string, elem string) []string {
+	return append(s[:len(s):len(s)], elem)
+}
+
+func toInt(node interface{}) (int64, bool) {
+	switch n := node.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), n <= math.MaxInt64
+	case float64:
+		return int64(n), n == math.Trunc(n) && n >= math.MinInt64 && n <= math.MaxInt64
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func toUint(node interface{}) (uint64, bool) {
+	if n, ok := node.(uint64); ok {
+		return n, true
+	}
+	if n, ok := node.(json.Number); ok {
+		u, err := strconv.ParseUint(string(n), 10, 64)
+		return u, err == nil
+	}
+	i, ok := toInt(node)
+	return uint64(i), ok && i >= 0
+}
+
+func toFloat(node interface{}) (float64, bool) {
+	switch n := node.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	i, ok := toInt(node)
+	return float64(i), ok
+}
+
+func isNumber(node interface{}) bool {
+	_, ok := node.(json.Number)
+	return ok
+}
+
+// scalar reports whether node is a single value rather than a
+// map or list.
+func scalar(node interface{}) bool {
+	switch reflect.ValueOf(node).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Invalid:
+		return false
+	}
+	return true
+}
+
+// describe names the kind of value node is for error messages.
+func describe(node interface{}) string {
+	switch node.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int, int64, uint64, float64, json.Number:
+		return "number"
+	case time.Time:
+		return "datetime"
+	}
+	switch reflect.ValueOf(node).Kind() {
+	case reflect.Map:
+		return "map"
+	case reflect.Slice:
+		return "list"
+	}
+	return fmt.Sprintf("%T", node)
+}
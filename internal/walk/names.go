@@ -0,0 +1,104 @@
+package walk
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/ande980/config/naming"
+)
+
+// Config returns the name given to f by its config tag, which
+// every source derives its own name from, or an empty string if
+// there isn't one. A nested struct can instead be named by a prefix
+// tag. ok is false if the field is excluded with "-".
+func Config(f reflect.StructField) (name string, ok bool) {
+	name = strings.Split(f.Tag.Get("config"), ",")[0]
+	if name == "" && isStruct(f.Type) {
+		name = f.Tag.Get("prefix")
+	}
+	return name, name != "-"
+}
+
+// Flatten reports whether the fields of f, a nested struct, belong
+// to its parent rather than being named after f. Embedded structs
+// are flattened unless they're given a name by tag, as they are
+// by encoding/json, and any struct field can be flattened with the
+// inline or squash option in its config tag or the source's tag.
+func Flatten(f reflect.StructField, tag string) bool {
+	if !isStruct(f.Type) {
+		return false
+	}
+
+	tags := []string{"config"}
+	if tag != "" {
+		tags = append(tags, tag)
+	}
+	named := f.Tag.Get("prefix") != ""
+	for _, t := range tags {
+		opts := strings.Split(f.Tag.Get(t), ",")
+		for _, opt := range opts[1:] {
+			if opt == "inline" || opt == "squash" {
+				return true
+			}
+		}
+		named = named || opts[0] != ""
+	}
+	return f.Anonymous && !named
+}
+
+func isStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// Key returns the name of f in a source using tag, such as a
+// file key. The source's own tag wins, then the config tag and
+// then the field name, converted by strategy if there is one. ok
+// is false if the field is excluded.
+func Key(f reflect.StructField, tag string, strategy naming.Strategy) (name string, ok bool) {
+	if tag != "" {
+		switch name = strings.Split(f.Tag.Get(tag), ",")[0]; name {
+		case "-":
+			return "", false
+		case "":
+		default:
+			return name, true
+		}
+	}
+
+	if name, ok = Config(f); !ok || name != "" {
+		return name, ok
+	}
+	if strategy != nil {
+		return strategy(f.Name), true
+	}
+	return f.Name, true
+}
+
+// Kebab converts a Go style name such as BaseURLPart to the
+// lower case, hyphenated form base-url-part. Runs of capitals
+// are treated as a single word.
+func Kebab(name string) string {
+	var canon string
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			switch {
+			case i == len(name)-1: // last char
+			case len(canon) == 0: // first char
+			default:
+				switch {
+				case unicode.IsLower(rune(name[i-1])):
+					canon += "-"
+				case unicode.IsLower(rune(name[i+1])) && !unicode.IsPunct(rune(canon[len(canon)-1])):
+					canon += "-"
+				}
+			}
+		}
+		canon += string(r)
+	}
+
+	return strings.ToLower(canon)
+}
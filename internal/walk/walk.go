@@ -0,0 +1,250 @@
+// Package walk visits the fields of configuration structs.
+package walk
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ande980/config/naming"
+)
+
+// Strings calls fn for every settable string field in v, which
+// may be a struct or a pointer to one, following pointers to
+// nested structs. path is the dotted Go path of the field.
+func Strings(v reflect.Value, fn func(path string, field reflect.Value)) {
+	visitStrings(v, "", fn)
+}
+
+func visitStrings(v reflect.Value, path string, fn func(string, reflect.Value)) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		fieldPath := f.Name
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.String && field.CanSet():
+			fn(fieldPath, field)
+		case field.Kind() == reflect.Struct, field.Kind() == reflect.Ptr:
+			visitStrings(field, fieldPath, fn)
+		}
+	}
+}
+
+// Assign stores val in the field found by following keys down
+// from v, a pointer to a struct. Each key is matched against the
+// name given by Key, exactly or failing that without regard to
+// case. Nil pointers along the way are allocated and a
+// map with string keys takes the next key as its index. It
+// returns the dotted Go path of the field, false if there is no
+// such field, and any error converting val.
+func Assign(v reflect.Value, tag string, strategy naming.Strategy, keys []string, val string) (string, bool, error) {
+	var path []string
+	for n, key := range keys {
+		var ok bool
+		if v, ok = alloc(v); !ok {
+			return "", false, nil
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			fields, ok := field(v.Type(), tag, strategy, key)
+			if !ok {
+				return "", false, nil
+			}
+			for j, f := range fields {
+				if j > 0 {
+					if v, ok = alloc(v); !ok {
+						return "", false, nil
+					}
+				}
+				v = v.Field(f.Index[0])
+				path = append(path, f.Name)
+			}
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String || n != len(keys)-1 {
+				return "", false, nil
+			}
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := Set(elem, val); err != nil {
+				return strings.Join(append(path, key), "."), true, err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+			return strings.Join(append(path, key), "."), true, nil
+		default:
+			return "", false, nil
+		}
+	}
+
+	v, ok := alloc(v)
+	if !ok || !v.CanSet() || v.Kind() == reflect.Struct {
+		return "", false, nil
+	}
+	return strings.Join(path, "."), true, Set(v, val)
+}
+
+// alloc follows pointers from v, allocating any that are nil.
+func alloc(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if !v.CanSet() {
+				return v, false
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v, true
+}
+
+// field finds the field named key in t, looking through flattened
+// structs, and returns the chain of fields leading to it.
+func field(t reflect.Type, tag string, strategy naming.Strategy, key string) ([]reflect.StructField, bool) {
+	var found []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if Flatten(f, tag) {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if chain, ok := field(ft, tag, strategy, key); ok && found == nil {
+				found = append([]reflect.StructField{f}, chain...)
+			}
+			continue
+		}
+		name, ok := Key(f, tag, strategy)
+		if !ok {
+			continue
+		}
+		if name == key {
+			return []reflect.StructField{f}, true
+		}
+		if found == nil && strings.EqualFold(name, key) {
+			found = []reflect.StructField{f}
+		}
+	}
+	return found, found != nil
+}
+
+// Settable reports whether Set understands fields of type t.
+func Settable(t reflect.Type) bool {
+	if t == reflect.TypeOf(time.Second) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// Set converts val to the type of field and stores it. Strings,
+// bools, ints, uints, float64 and time.Duration are understood,
+// anything else is left alone.
+func Set(field reflect.Value, val string) error {
+	// Special case - has to go first or it clashes with *int64
+	if field.Type() == reflect.TypeOf(time.Second) {
+		dur, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("parsing duration: %v", err)
+		}
+		field.Set(reflect.ValueOf(dur))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(val)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return toCorrectIntType(field, val)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return toCorrectUintType(field, val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("parsing bool: %v", err)
+		}
+		field.SetBool(b)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("parsing float: %v", err)
+		}
+		field.SetFloat(f)
+	}
+	return nil
+}
+
+func toCorrectIntType(v reflect.Value, s string) error {
+	ival, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parsing int: %v", err)
+	}
+
+	switch v.Kind() {
+	case reflect.Int:
+		v.Set(reflect.ValueOf(int(ival)))
+	case reflect.Int8:
+		v.Set(reflect.ValueOf(int8(ival)))
+	case reflect.Int16:
+		v.Set(reflect.ValueOf(int16(ival)))
+	case reflect.Int32:
+		v.Set(reflect.ValueOf(int32(ival)))
+	case reflect.Int64:
+		v.SetInt(ival)
+	default:
+		return &reflect.ValueError{Method: "toCorrectIntType", Kind: v.Kind()}
+	}
+	return nil
+}
+
+func toCorrectUintType(v reflect.Value, s string) error {
+	ival, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parsing int: %v", err)
+	}
+
+	switch v.Kind() {
+	case reflect.Uint:
+		v.Set(reflect.ValueOf(uint(ival)))
+	case reflect.Uint8:
+		v.Set(reflect.ValueOf(uint8(ival)))
+	case reflect.Uint16:
+		v.Set(reflect.ValueOf(uint16(ival)))
+	case reflect.Uint32:
+		v.Set(reflect.ValueOf(uint32(ival)))
+	case reflect.Uint64:
+		v.SetUint(ival)
+	default:
+		return &reflect.ValueError{Method: "toCorrectUintType", Kind: v.Kind()}
+	}
+	return nil
+}
@@ -8,14 +8,51 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+
+	"github.com/ande980/config/crypt"
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/internal/expand"
+	"github.com/ande980/config/internal/format"
+	"github.com/ande980/config/internal/locate"
+	"github.com/ande980/config/internal/walk"
+	"github.com/ande980/config/naming"
+	"github.com/ande980/config/secret"
 )
 
 // Provider is a config provider that reads from a JSON
 // file or io.Reader and scans into the specified struct.
 type Provider struct {
-	r   io.Reader
-	err error
+	r         io.Reader
+	path      string
+	err       error
+	expand    bool
+	strict    bool
+	resolver  secret.Resolver
+	decrypter crypt.Decrypter
+	relaxed   bool
+	naming    naming.Strategy
+}
+
+func init() {
+	for _, name := range []string{"json", "jsonc", "json5"} {
+		relaxed := name != "json"
+		format.Register(name, func(r io.Reader, path string, o format.Options) format.Parser {
+			p := WithReader(r)
+			if path != "" {
+				p = WithPath(path)
+			}
+			if relaxed {
+				p.Relaxed()
+			}
+			p.WithResolver(o.Resolver).WithDecrypter(o.Decrypter).WithNaming(o.Naming)
+			if o.Expand {
+				p.ExpandEnv(o.Strict)
+			}
+			return p
+		})
+	}
 }
 
 // New is the default way to create a json Provider. The entire
@@ -29,14 +66,16 @@ func New() *Provider {
 
 // WithPath allows for a non-standard configuration file to be
 // specified at runtime. If there is an error reading the file it
-// is stored in Provider and returned during Parse.
+// is stored in Provider and returned during Parse. Files with a
+// .jsonc or .json5 extension are read as if Relaxed was called.
 func WithPath(path string) *Provider {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return &Provider{strings.NewReader("{}"), nil} // No-op reader, but one that doesn't generate io.EOF
+		return &Provider{r: strings.NewReader("{}")} // No-op reader, but one that doesn't generate io.EOF
 	}
 
 	buf, err := ioutil.ReadFile(path)
-	p := &Provider{r: bytes.NewReader(buf)}
+	ext := filepath.Ext(path)
+	p := &Provider{r: bytes.NewReader(buf), path: path, relaxed: ext == ".jsonc" || ext == ".json5"}
 	if err != nil {
 		p.err = fmt.Errorf("reading configuration file: %v", err)
 	}
@@ -45,17 +84,160 @@ func WithPath(path string) *Provider {
 
 // WithReader accepts a reader and returns a json Provider.
 func WithReader(r io.Reader) *Provider {
-	return &Provider{r, nil}
+	return &Provider{r: r}
 }
 
-// Parse implements the config.Provider interface.
+// ExpandEnv enables ${NAME} and ${NAME:-default} placeholders
+// in the file, which are replaced with environmental variables
+// before decoding. $$ is a literal $. An unset variable with no
+// default expands to nothing unless strict is true, in which
+// case Parse returns an error for each one. Values are inserted
+// as they are so they must be valid JSON where they're used.
+func (p *Provider) ExpandEnv(strict bool) *Provider {
+	p.expand = true
+	p.strict = strict
+	return p
+}
+
+// Relaxed accepts the JSONC and JSON5 additions most useful in
+// configuration files: // and /* */ comments, trailing commas,
+// unquoted keys and single quoted strings. The document is bound
+// to the struct as standard JSON would be, so tags work as normal.
+func (p *Provider) Relaxed() *Provider {
+	p.relaxed = true
+	return p
+}
+
+// WithResolver sets the secret.Resolver that string values are
+// passed through as they are decoded, such as secret.Default() for
+// file:// references. Without one values are stored as they are.
+func (p *Provider) WithResolver(r secret.Resolver) *Provider {
+	p.resolver = r
+	return p
+}
+
+// WithDecrypter enables decryption of ENC[...] values in the
+// file before decoding. See the crypt package.
+func (p *Provider) WithDecrypter(d crypt.Decrypter) *Provider {
+	p.decrypter = d
+	return p
+}
+
+// WithNaming sets the strategy that turns the names of fields
+// without a tag into keys, such as naming.Snake for proxy_addr.
+// By default field names are matched without regard to case.
+func (p *Provider) WithNaming(s naming.Strategy) *Provider {
+	p.naming = s
+	return p
+}
+
+// Parse implements the config.Provider interface. Decoding
+// errors are returned as a *errs.FileError (config.FileError)
+// locating the problem in the file.
 func (p *Provider) Parse(i interface{}) error {
 	if p.err != nil {
 		return p.err
 	}
 
-	if err := json.NewDecoder(p.r).Decode(i); err != nil && err != io.EOF {
-		return fmt.Errorf("decoding json file: %v", err)
+	buf, err := ioutil.ReadAll(p.r)
+	if err != nil {
+		return fmt.Errorf("reading configuration: %v", err)
+	}
+
+	var m *expand.Map
+	if p.expand {
+		if buf, m, err = expand.File(buf, p.path, "json", p.strict); err != nil {
+			return err
+		}
+	}
+
+	if p.decrypter != nil {
+		decrypted, err := crypt.Decrypt(buf, p.decrypter)
+		if err != nil {
+			return m.Locate(p.fileError(&source{buf: buf}, err))
+		}
+		buf = decrypted
+	}
+
+	src := &source{buf: buf}
+	if p.relaxed {
+		src.orig = buf
+		src.buf, src.pos = relax(buf)
+	}
+
+	var tree interface{}
+	dec := json.NewDecoder(bytes.NewReader(src.buf))
+	dec.UseNumber()
+	if err := dec.Decode(&tree); err != nil && err != io.EOF {
+		return m.Locate(p.fileError(src, err))
+	}
+
+	return m.Locate(p.bind(src, i, tree))
+}
+
+// source is the text handed to the decoder. When relaxed syntax
+// has been rewritten orig holds the text as it was written and pos
+// the offset in orig of every byte in buf.
+type source struct {
+	buf  []byte
+	orig []byte
+	pos  []int
+}
+
+// position returns the line and column of offset, which is an
+// offset into buf, in the text as it was written.
+func (s *source) position(offset int64) (int, int) {
+	if s.pos == nil || offset < 0 {
+		return errs.Position(s.buf, offset)
+	}
+	if offset >= int64(len(s.pos)) {
+		return errs.Position(s.orig, int64(len(s.orig)))
+	}
+	return errs.Position(s.orig, int64(s.pos[offset]))
+}
+
+// fileError locates err in the file.
+func (p *Provider) fileError(src *source, err error) error {
+	fe := &errs.FileError{Path: p.path, Format: "json", Err: err}
+	switch e := err.(type) {
+	case *crypt.Error:
+		fe.Line, fe.Column = src.position(int64(e.Offset))
+	case *json.SyntaxError:
+		fe.Line, fe.Column = src.position(e.Offset - 1)
+	}
+	return fe
+}
+
+// bind stores the decoded tree in i. Fields are named by their
+// json tag, config tag or field name, and values that can't be
+// stored are reported as FieldErrors located in the file.
+func (p *Provider) bind(src *source, i interface{}, tree interface{}) error {
+	b := &walk.Binder{Tag: "json", Naming: p.naming, Custom: custom, JSON: true}
+	if p.resolver != nil {
+		b.Resolve = p.resolver.Resolve
+	}
+
+	var result errs.Errors
+	for _, e := range b.Bind(reflect.ValueOf(i), tree) {
+		key := strings.Join(e.Keys, ".")
+		fe := &errs.FileError{Path: p.path, Format: "json", Key: key, Err: e.Err}
+		if span, ok := locate.JSON(src.buf, e.Keys); ok {
+			fe.Line, fe.Column = src.position(int64(span.Start))
+		}
+		result = append(result, &errs.FieldError{Path: e.Path, Source: "json", Key: key, Value: e.Value, Err: fe})
+	}
+	return result.ErrorOrNil()
+}
+
+// custom hands values to types that decode JSON themselves.
+func custom(node, ptr interface{}) (bool, error) {
+	u, ok := ptr.(json.Unmarshaler)
+	if !ok {
+		return false, nil
+	}
+	buf, err := json.Marshal(node)
+	if err != nil {
+		return true, err
 	}
-	return nil
+	return true, u.UnmarshalJSON(buf)
 }
@@ -1,9 +1,18 @@
 package json
 
 import (
+	stdjson "encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/secret"
 )
 
 type Config struct {
@@ -67,3 +76,172 @@ func TestNoFile(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestFileError(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		line int
+		col  int
+		key  string
+		path string
+	}{
+		{
+			"syntax", "{\n  \"abcd\": \"x\",\n  \"B\" true\n}", 3, 7, "", "",
+		},
+		{
+			"type", "{\n  \"Server\": {\n    \"Addr\": 9090\n  }\n}", 3, 13, "Server.Addr", "Server.Addr",
+		},
+	}
+
+	for _, test := range tests {
+		err := WithReader(strings.NewReader(test.in)).Parse(&Config{})
+		var fe *errs.FileError
+		if !errors.As(err, &fe) {
+			t.Errorf("%s: expected *errs.FileError, got %T", test.name, err)
+			continue
+		}
+
+		var fieldErr *errs.FieldError
+		if errors.As(err, &fieldErr) != (test.path != "") || (fieldErr != nil && fieldErr.Path != test.path) {
+			t.Errorf("%s: expected field '%s', got %v", test.name, test.path, fieldErr)
+		}
+
+		if fe.Format != "json" || fe.Line != test.line || fe.Column != test.col || fe.Key != test.key {
+			t.Errorf("%s: expected json %d:%d '%s', got %s %d:%d '%s'", test.name, test.line, test.col, test.key, fe.Format, fe.Line, fe.Column, fe.Key)
+		}
+	}
+}
+
+func TestRelaxed(t *testing.T) {
+	cfg := &Config{}
+	r := strings.NewReader(`// Leading comment
+{
+  /* The name, "quoted" */
+  abcd: 'say "hi" it\'s me', // trailing comment
+  B: true,
+  Server: {
+    "Addr": ":9090",
+  },
+}`)
+	if err := WithReader(r).Relaxed().Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.A != `say "hi" it's me` {
+		t.Errorf("expected '%s', got '%s'", `say "hi" it's me`, cfg.A)
+	}
+
+	if !cfg.B {
+		t.Errorf("expected %t, got %t", true, cfg.B)
+	}
+
+	if cfg.Server == nil || cfg.Server.Addr != ":9090" {
+		t.Errorf("expected '%s', got %v", ":9090", cfg.Server)
+	}
+
+	err := WithReader(strings.NewReader("{\n  // Port\n  Server: {Addr: 9090},\n}")).Relaxed().Parse(&Config{})
+	var fe *errs.FileError
+	if !errors.As(err, &fe) || fe.Line != 3 || fe.Column != 18 {
+		t.Errorf("expected an error at 3:18, got %v", err)
+	}
+
+	if err := WithReader(strings.NewReader("{\"B\": true, // comment\n}")).Parse(&Config{}); err == nil {
+		t.Error("expected comments to be rejected without Relaxed")
+	}
+}
+
+func TestResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "db.sqlite")
+	if err := ioutil.WriteFile(path, []byte("contents\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	doc := `{"abcd": "file://` + path + `"}`
+
+	cfg := &Config{}
+	if err := WithReader(strings.NewReader(doc)).Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.A != "file://"+path {
+		t.Errorf("expected '%s' to be left alone, got '%s'", "file://"+path, cfg.A)
+	}
+
+	if err := WithReader(strings.NewReader(doc)).WithResolver(secret.Default()).Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.A != "contents" {
+		t.Errorf("expected '%s', got '%s'", "contents", cfg.A)
+	}
+
+	err = WithReader(strings.NewReader(`{"abcd": "file://` + filepath.Join(dir, "missing") + `"}`)).WithResolver(secret.Default()).Parse(cfg)
+	var fe *errs.FileError
+	if !errors.As(err, &fe) || fe.Key != "abcd" {
+		t.Errorf("expected a FileError for abcd, got '%v'", err)
+	}
+}
+
+// TestEncodingJSON checks that values encoding/json treats
+// specially are decoded as it decodes them.
+func TestEncodingJSON(t *testing.T) {
+	type common struct {
+		Region string `json:"region"`
+	}
+	type Quoted struct {
+		common
+		Port    int      `json:"port,string"`
+		Ratio   float64  `json:"ratio,string"`
+		Debug   *bool    `json:"debug,string"`
+		Name    string   `json:"name,string"`
+		Key     []byte   `json:"key"`
+		Missing []byte   `json:"missing"`
+		Tags    []string `json:"tags,string"`
+		Extra   map[string]interface{}
+		Any     interface{}
+	}
+
+	in := `{"port":"8080","ratio":"0.5","debug":"true","name":"\"app\"","key":"c2VjcmV0","missing":null,"tags":["a"],
+		"region":"eu","Extra":{"n":1,"list":[2.5]},"Any":3}`
+
+	expected := &Quoted{}
+	if err := stdjson.Unmarshal([]byte(in), expected); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Quoted{}
+	if err := WithReader(strings.NewReader(in)).Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("expected %+v, got %+v", expected, cfg)
+	}
+	if cfg.Port != 8080 || string(cfg.Key) != "secret" {
+		t.Errorf("expected 8080 and 'secret', got %d and '%s'", cfg.Port, cfg.Key)
+	}
+	if cfg.Region != "eu" || cfg.Extra["n"] != float64(1) || cfg.Any != float64(3) {
+		t.Errorf("expected eu, 1 and 3, got %s, %#v and %#v", cfg.Region, cfg.Extra["n"], cfg.Any)
+	}
+
+	tests := []struct {
+		in  string
+		key string
+	}{
+		{`{"port":8080}`, "port"},
+		{`{"port":"eighty"}`, "port"},
+		{`{"key":"not base64!"}`, "key"},
+	}
+
+	for _, test := range tests {
+		err := WithReader(strings.NewReader(test.in)).Parse(&Quoted{})
+
+		var fe *errs.FieldError
+		if !errors.As(err, &fe) || fe.Key != test.key {
+			t.Errorf("%s: expected an error for %s, got '%v'", test.in, test.key, err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package json
+
+// relax rewrites JSONC and JSON5 style input as standard JSON so
+// it can be decoded by encoding/json. Comments and trailing commas
+// are dropped, unquoted keys are quoted and single quoted strings
+// are double quoted. Anything else, valid or not, is passed through
+// for the decoder to deal with. The returned slice holds the input
+// offset of every output byte so errors can be located in the file
+// as it was written.
+func relax(buf []byte) ([]byte, []int) {
+	out := make([]byte, 0, len(buf))
+	pos := make([]int, 0, len(buf))
+	emit := func(b byte, at int) {
+		out = append(out, b)
+		pos = append(pos, at)
+	}
+
+	for i := 0; i < len(buf); i++ {
+		c := buf[i]
+		switch {
+		case c == '"':
+			end := stringEnd(buf, i)
+			for j := i; j < end; j++ {
+				emit(buf[j], j)
+			}
+			i = end - 1
+		case c == '\'':
+			end := stringEnd(buf, i)
+			emit('"', i)
+			for j := i + 1; j < end; j++ {
+				switch {
+				case buf[j] == '\\' && j+1 < end && buf[j+1] == '\'':
+					j++
+					emit('\'', j)
+				case buf[j] == '\\' && j+1 < end:
+					emit(buf[j], j)
+					j++
+					emit(buf[j], j)
+				case buf[j] == '"':
+					emit('\\', j)
+					emit('"', j)
+				case buf[j] == '\'' && j == end-1:
+					emit('"', j)
+				default:
+					emit(buf[j], j)
+				}
+			}
+			i = end - 1
+		case c == '/' && i+1 < len(buf) && (buf[i+1] == '/' || buf[i+1] == '*'):
+			i = commentEnd(buf, i) - 1
+		case c == ',':
+			if j := skipSpace(buf, i+1); j < len(buf) && (buf[j] == '}' || buf[j] == ']') {
+				continue
+			}
+			emit(c, i)
+		case isIdentStart(c):
+			end := i + 1
+			for end < len(buf) && isIdent(buf[end]) {
+				end++
+			}
+			key := skipSpace(buf, end) < len(buf) && buf[skipSpace(buf, end)] == ':'
+			if key {
+				emit('"', i)
+			}
+			for j := i; j < end; j++ {
+				emit(buf[j], j)
+			}
+			if key {
+				emit('"', end-1)
+			}
+			i = end - 1
+		default:
+			emit(c, i)
+		}
+	}
+	return out, pos
+}
+
+// stringEnd returns the offset just past the string starting at
+// buf[start], which is closed by the same quote it opened with.
+func stringEnd(buf []byte, start int) int {
+	for i := start + 1; i < len(buf); i++ {
+		switch buf[i] {
+		case '\\':
+			i++
+		case buf[start]:
+			return i + 1
+		}
+	}
+	return len(buf)
+}
+
+// commentEnd returns the offset just past the comment starting
+// at buf[start]. Line comments end before the newline.
+func commentEnd(buf []byte, start int) int {
+	if buf[start+1] == '/' {
+		for i := start; i < len(buf); i++ {
+			if buf[i] == '\n' {
+				return i
+			}
+		}
+		return len(buf)
+	}
+	for i := start + 2; i+1 < len(buf); i++ {
+		if buf[i] == '*' && buf[i+1] == '/' {
+			return i + 2
+		}
+	}
+	return len(buf)
+}
+
+// skipSpace returns the offset of the next byte that isn't
+// whitespace or part of a comment.
+func skipSpace(buf []byte, i int) int {
+	for i < len(buf) {
+		switch {
+		case buf[i] == ' ' || buf[i] == '\t' || buf[i] == '\r' || buf[i] == '\n':
+			i++
+		case buf[i] == '/' && i+1 < len(buf) && (buf[i+1] == '/' || buf[i+1] == '*'):
+			i = commentEnd(buf, i)
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdent(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
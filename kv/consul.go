@@ -0,0 +1,178 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Consul is a KVStore backed by the key/value API of a Consul
+// agent. Consul keys don't start with a slash so a leading one is
+// dropped from keys and prefixes.
+type Consul struct {
+	addr       string
+	client     *http.Client
+	token      string
+	datacenter string
+}
+
+// NewConsul returns a Consul talking to the agent at addr, such as
+// http://127.0.0.1:8500, with http.DefaultClient.
+func NewConsul(addr string) *Consul {
+	return &Consul{addr: strings.TrimSuffix(addr, "/")}
+}
+
+// WithClient replaces the http.Client used to make requests, such
+// as one configured for TLS. Watch makes blocking queries that last
+// up to five minutes, so the client's timeout must be longer.
+func (c *Consul) WithClient(client *http.Client) *Consul {
+	c.client = client
+	return c
+}
+
+// WithToken sends an ACL token with every request.
+func (c *Consul) WithToken(token string) *Consul {
+	c.token = token
+	return c
+}
+
+// WithDatacenter queries datacenter rather than the agent's own.
+func (c *Consul) WithDatacenter(datacenter string) *Consul {
+	c.datacenter = datacenter
+	return c
+}
+
+// consulPair is an entry in the response to a recursive read.
+type consulPair struct {
+	Key   string
+	Value []byte
+}
+
+// Get implements KVStore.
+func (c *Consul) Get(key string) ([]byte, error) {
+	resp, err := c.get(context.Background(), key, url.Values{"raw": {""}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// List implements KVStore.
+func (c *Consul) List(prefix string) ([]Pair, error) {
+	pairs, _, err := c.list(context.Background(), prefix, 0)
+	return pairs, err
+}
+
+// Watch implements KVStore with blocking queries, which return
+// when the index of the prefix moves past the one given.
+func (c *Consul) Watch(ctx context.Context, prefix string, fn func(error)) error {
+	var index uint64
+	for {
+		_, next, err := c.list(ctx, prefix, index)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			fn(err)
+			if !wait(ctx) {
+				return ctx.Err()
+			}
+			continue
+		case index != 0 && next != index:
+			fn(nil)
+		}
+
+		// The index can go backwards if the agent's state is reset,
+		// in which case the next query mustn't wait on the old one.
+		if next < index {
+			next = 0
+		}
+		index = next
+	}
+}
+
+// list reads the pairs under prefix, blocking until the index of
+// the prefix is past index if it isn't zero, and returns them with
+// the current index.
+func (c *Consul) list(ctx context.Context, prefix string, index uint64) ([]Pair, uint64, error) {
+	query := url.Values{"recurse": {""}}
+	if index != 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", "5m")
+	}
+
+	resp, err := c.get(ctx, prefix, query)
+	if err == ErrNotFound {
+		return nil, consulIndex(resp), nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	var entries []consulPair
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("decoding consul response: %v", err)
+	}
+
+	pairs := make([]Pair, 0, len(entries))
+	for _, e := range entries {
+		pairs = append(pairs, Pair{Key: e.Key, Value: e.Value})
+	}
+	return pairs, consulIndex(resp), nil
+}
+
+// get requests key from the key/value API. A 404 is returned as
+// ErrNotFound along with the response, its body already closed.
+func (c *Consul) get(ctx context.Context, key string, query url.Values) (*http.Response, error) {
+	segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	if c.datacenter != "" {
+		query.Set("dc", c.datacenter)
+	}
+	u := c.addr + "/v1/kv/" + strings.Join(segments, "/") + "?" + query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	client := c.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return resp, ErrNotFound
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return nil, fmt.Errorf("consul: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// consulIndex returns the X-Consul-Index of resp, or 0.
+func consulIndex(resp *http.Response) uint64 {
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	return index
+}
@@ -0,0 +1,224 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Etcd is a KVStore backed by the JSON gateway of etcd's v3 API.
+// Keys are used as they are, so a leading slash is part of the key.
+type Etcd struct {
+	addr   string
+	client *http.Client
+	token  string
+}
+
+// NewEtcd returns an Etcd talking to the member at addr, such as
+// http://127.0.0.1:2379, with http.DefaultClient.
+func NewEtcd(addr string) *Etcd {
+	return &Etcd{addr: strings.TrimSuffix(addr, "/")}
+}
+
+// WithClient replaces the http.Client used to make requests, such
+// as one configured with client certificates. Watch holds a request
+// open indefinitely, so the client mustn't have a timeout.
+func (e *Etcd) WithClient(client *http.Client) *Etcd {
+	e.client = client
+	return e
+}
+
+// WithToken sends an authentication token, as returned by
+// /v3/auth/authenticate, with every request.
+func (e *Etcd) WithToken(token string) *Etcd {
+	e.token = token
+	return e
+}
+
+// The gateway encodes keys and values in base64, which []byte
+// fields are decoded from, and 64 bit integers as strings.
+type (
+	etcdRange struct {
+		Key      []byte `json:"key"`
+		RangeEnd []byte `json:"range_end,omitempty"`
+	}
+	etcdHeader struct {
+		Revision int64 `json:"revision,string"`
+	}
+	etcdKV struct {
+		Key   []byte `json:"key"`
+		Value []byte `json:"value"`
+	}
+	etcdRangeResponse struct {
+		Header etcdHeader `json:"header"`
+		KVs    []etcdKV   `json:"kvs"`
+	}
+	etcdWatchCreate struct {
+		Key           []byte `json:"key"`
+		RangeEnd      []byte `json:"range_end,omitempty"`
+		StartRevision int64  `json:"start_revision,string,omitempty"`
+	}
+	etcdWatchRequest struct {
+		CreateRequest etcdWatchCreate `json:"create_request"`
+	}
+	etcdWatchResponse struct {
+		Result struct {
+			Header   etcdHeader        `json:"header"`
+			Canceled bool              `json:"canceled"`
+			Reason   string            `json:"cancel_reason"`
+			Events   []json.RawMessage `json:"events"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+)
+
+// Get implements KVStore.
+func (e *Etcd) Get(key string) ([]byte, error) {
+	var resp etcdRangeResponse
+	if err := e.call("/v3/kv/range", etcdRange{Key: []byte(key)}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.KVs) == 0 {
+		return nil, ErrNotFound
+	}
+	return resp.KVs[0].Value, nil
+}
+
+// List implements KVStore.
+func (e *Etcd) List(prefix string) ([]Pair, error) {
+	key, end := prefixRange(prefix)
+	var resp etcdRangeResponse
+	if err := e.call("/v3/kv/range", etcdRange{Key: key, RangeEnd: end}, &resp); err != nil {
+		return nil, err
+	}
+
+	pairs := make([]Pair, 0, len(resp.KVs))
+	for _, kv := range resp.KVs {
+		pairs = append(pairs, Pair{Key: string(kv.Key), Value: kv.Value})
+	}
+	return pairs, nil
+}
+
+// Watch implements KVStore with a watch stream. If the stream is
+// broken it's opened again from the revision after the last one
+// seen, so no changes are missed.
+func (e *Etcd) Watch(ctx context.Context, prefix string, fn func(error)) error {
+	key, end := prefixRange(prefix)
+	var revision int64
+	for {
+		create := etcdWatchCreate{Key: key, RangeEnd: end}
+		if revision != 0 {
+			create.StartRevision = revision + 1
+		}
+		err := e.watch(ctx, etcdWatchRequest{create}, func(header etcdHeader) {
+			revision = header.Revision
+			fn(nil)
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		fn(err)
+		if !wait(ctx) {
+			return ctx.Err()
+		}
+	}
+}
+
+// watch opens a watch stream with req and calls changed for each
+// response carrying events until the stream ends.
+func (e *Etcd) watch(ctx context.Context, req etcdWatchRequest, changed func(etcdHeader)) error {
+	resp, err := e.post(ctx, "/v3/watch", req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg etcdWatchResponse
+		if err := dec.Decode(&msg); err == io.EOF {
+			return fmt.Errorf("etcd: watch closed")
+		} else if err != nil {
+			return fmt.Errorf("etcd: decoding watch response: %v", err)
+		}
+
+		switch {
+		case msg.Error != nil:
+			return fmt.Errorf("etcd: %s", msg.Error.Message)
+		case msg.Result.Canceled:
+			return fmt.Errorf("etcd: watch canceled: %s", msg.Result.Reason)
+		case len(msg.Result.Events) > 0:
+			changed(msg.Result.Header)
+		}
+	}
+}
+
+// call posts req to path and decodes the response into resp.
+func (e *Etcd) call(path string, req, resp interface{}) error {
+	r, err := e.post(context.Background(), path, req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(resp); err != nil {
+		return fmt.Errorf("etcd: decoding response: %v", err)
+	}
+	return nil
+}
+
+func (e *Etcd) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.addr+path, bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if e.token != "" {
+		req.Header.Set("Authorization", e.token)
+	}
+
+	client := e.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("etcd: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// prefixRange returns the range of keys starting with prefix as
+// etcd expresses it: from prefix up to, but not including, prefix
+// with its last byte incremented. An empty prefix is every key.
+func prefixRange(prefix string) (key, end []byte) {
+	if prefix == "" {
+		return []byte{0}, []byte{0}
+	}
+	key = []byte(prefix)
+	end = append([]byte(nil), key...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return key, end[:i+1]
+		}
+	}
+	// Every byte is 0xff so there's no upper bound.
+	return key, []byte{0}
+}
@@ -0,0 +1,132 @@
+// Package kv provides a config provider for key/value stores such
+// as etcd and Consul. The keys under a prefix are mapped onto the
+// struct with each path segment naming a field, so given the prefix
+// /services/app/ the key /services/app/server/tls/cert sets
+// Server.TLS.Cert. Stores are reached through the KVStore interface,
+// which Memory, Consul and Etcd implement.
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/internal/walk"
+	"github.com/ande980/config/naming"
+)
+
+// ErrNotFound is returned by KVStore.Get for a key that isn't set.
+var ErrNotFound = errors.New("key not found")
+
+// retry is how long a Watch waits before trying again after the
+// store couldn't be reached.
+var retry = time.Second
+
+// Pair is a key and its value.
+type Pair struct {
+	Key   string
+	Value []byte
+}
+
+// KVStore is a hierarchical key/value store with keys separated
+// by slashes.
+type KVStore interface {
+	// Get returns the value of key, or ErrNotFound.
+	Get(key string) ([]byte, error)
+	// List returns every pair with a key starting with prefix.
+	List(prefix string) ([]Pair, error)
+	// Watch calls fn with nil whenever a key starting with prefix
+	// is set or deleted, or with the error if the store can't be
+	// watched, until ctx is done. It blocks and returns ctx.Err().
+	Watch(ctx context.Context, prefix string, fn func(error)) error
+}
+
+// Provider is a config provider that reads the keys under a prefix
+// from a KVStore and scans them into the specified struct. Names
+// are matched against the kv tag, then the field name without
+// regard to case.
+type Provider struct {
+	store  KVStore
+	prefix string
+	naming naming.Strategy
+}
+
+// New returns a Provider reading the keys under prefix in store.
+// A trailing slash is added to prefix if it doesn't have one, so
+// /services/app doesn't take in /services/application.
+func New(store KVStore, prefix string) *Provider {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &Provider{store: store, prefix: prefix}
+}
+
+// WithNaming sets the strategy that turns the names of fields
+// without a tag into path segments, such as naming.Snake for
+// proxy_addr. By default field names are matched without regard to
+// case.
+func (p *Provider) WithNaming(s naming.Strategy) *Provider {
+	p.naming = s
+	return p
+}
+
+// Parse implements the config.Provider interface. Keys that don't
+// match a field are ignored, as are keys ending in a slash, which
+// some stores use for directories.
+func (p *Provider) Parse(i interface{}) error {
+	pairs, err := p.store.List(p.prefix)
+	if err != nil {
+		return fmt.Errorf("listing %s: %v", p.prefix, err)
+	}
+
+	prefix := strings.TrimPrefix(p.prefix, "/")
+	var result errs.Errors
+	for _, pair := range pairs {
+		rel := strings.TrimPrefix(pair.Key, "/")
+		if !strings.HasPrefix(rel, prefix) || strings.HasSuffix(rel, "/") {
+			continue
+		}
+
+		var keys []string
+		for _, key := range strings.Split(rel[len(prefix):], "/") {
+			if key != "" {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		value := string(pair.Value)
+		path, _, err := walk.Assign(reflect.ValueOf(i), "kv", p.naming, keys, value)
+		if err != nil {
+			result = append(result, &errs.FieldError{Path: path, Source: "kv", Key: pair.Key, Value: value, Err: err})
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+// Watch calls fn with nil whenever a key under the prefix changes,
+// so the configuration can be parsed again, or with the error if
+// the store can't be watched, until ctx is done. It blocks so is
+// usually run in its own goroutine, and returns ctx.Err().
+func (p *Provider) Watch(ctx context.Context, fn func(error)) error {
+	return p.store.Watch(ctx, p.prefix, fn)
+}
+
+// wait pauses for the retry interval, returning false if ctx is
+// done first.
+func wait(ctx context.Context) bool {
+	t := time.NewTimer(retry)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,360 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ande980/config/internal/errs"
+)
+
+type Config struct {
+	Name     string
+	Port     int
+	Timeout  time.Duration
+	MaxConns int `kv:"max_conns"`
+	Labels   map[string]string
+	Server   *Server
+}
+
+type Server struct {
+	Host string
+	TLS  TLS
+}
+
+type TLS struct {
+	Cert string
+}
+
+var pairs = map[string]string{
+	"/services/app/name":            "app",
+	"/services/app/port":            "8080",
+	"/services/app/timeout":         "5s",
+	"/services/app/max_conns":       "100",
+	"/services/app/labels/team":     "platform",
+	"/services/app/server/":         "",
+	"/services/app/server/host":     "example.com",
+	"/services/app/server/tls/cert": "/etc/app.pem",
+	"/services/app/unknown":         "ignored",
+	"/services/application/name":    "other",
+}
+
+// check parses the configuration under /services/app/ from store.
+func check(t *testing.T, store KVStore) {
+	t.Helper()
+
+	cfg := &Config{}
+	if err := New(store, "/services/app").Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Name != "app" || cfg.Port != 8080 || cfg.Timeout != 5*time.Second || cfg.MaxConns != 100 {
+		t.Errorf("unexpected configuration %+v", cfg)
+	}
+	if cfg.Labels["team"] != "platform" {
+		t.Errorf("expected label %q, got %v", "platform", cfg.Labels)
+	}
+	if cfg.Server == nil || cfg.Server.Host != "example.com" || cfg.Server.TLS.Cert != "/etc/app.pem" {
+		t.Errorf("unexpected server %+v", cfg.Server)
+	}
+}
+
+// watch waits for a change under /services/app/ in store after put
+// is called.
+func watch(t *testing.T, store KVStore, put func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ready := make(chan struct{})
+	changes := make(chan error, 10)
+	done := make(chan error)
+	go func() {
+		close(ready)
+		done <- New(store, "/services/app/").Watch(ctx, func(err error) {
+			changes <- err
+		})
+	}()
+	<-ready
+
+	// Give the watch time to start before changing anything, and
+	// keep changing until it's seen in case it hadn't.
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+	for seen := false; !seen; {
+		select {
+		case err := <-changes:
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen = true
+		case <-ticker.C:
+			put()
+		case <-timeout:
+			t.Fatal("timed out waiting for a change")
+		}
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory(pairs)
+	check(t, m)
+
+	if value, err := m.Get("/services/app/name"); err != nil || string(value) != "app" {
+		t.Errorf("expected %q, got %q, %v", "app", value, err)
+	}
+	m.Delete("/services/app/name")
+	if _, err := m.Get("/services/app/name"); err != ErrNotFound {
+		t.Errorf("expected %v, got %v", ErrNotFound, err)
+	}
+
+	watch(t, m, func() { m.Put("/services/app/name", []byte("changed")) })
+	watch(t, m, func() { m.Delete("/services/app/name") })
+}
+
+func TestErrors(t *testing.T) {
+	m := NewMemory(map[string]string{"app/port": "eighty"})
+
+	err := New(m, "app/").Parse(&Config{})
+	list, ok := err.(errs.Errors)
+	if !ok || len(list) != 1 {
+		t.Fatalf("expected one error, got %v", err)
+	}
+	fe := list[0].(*errs.FieldError)
+	if fe.Path != "Port" || fe.Source != "kv" || fe.Key != "app/port" || fe.Value != "eighty" {
+		t.Errorf("unexpected error %#v", fe)
+	}
+}
+
+// fake is the key/value store behind the fake Consul and etcd
+// servers. Every change increments the index and wakes waiters.
+type fake struct {
+	mu      sync.Mutex
+	pairs   map[string]string
+	index   uint64
+	changed chan struct{}
+}
+
+func newFake() *fake {
+	f := &fake{pairs: make(map[string]string), index: 1, changed: make(chan struct{})}
+	for k, v := range pairs {
+		f.pairs[k] = v
+	}
+	return f
+}
+
+func (f *fake) put(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pairs[key] = value
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// snapshot returns the sorted keys matching fn, the index and a
+// channel closed by the next change.
+func (f *fake) snapshot(fn func(key string) bool) ([]string, uint64, chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for k := range f.pairs {
+		if fn(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, f.index, f.changed
+}
+
+// consul serves the parts of Consul's key/value API used by Consul.
+// Keys are stored without a leading slash as Consul stores them.
+func (f *fake) consul(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Consul-Token") != "secret" {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	query := r.URL.Query()
+	_, recurse := query["recurse"]
+	match := func(k string) bool {
+		k = strings.TrimPrefix(k, "/")
+		if recurse {
+			return strings.HasPrefix(k, key)
+		}
+		return k == key
+	}
+
+	keys, index, changed := f.snapshot(match)
+	if query.Get("index") == strconv.FormatUint(index, 10) {
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+		keys, index, _ = f.snapshot(match)
+	}
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+	if len(keys) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !recurse {
+		w.Write([]byte(f.pairs[keys[0]]))
+		return
+	}
+	var entries []consulPair
+	for _, k := range keys {
+		entries = append(entries, consulPair{Key: strings.TrimPrefix(k, "/"), Value: []byte(f.pairs[k])})
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+// inRange reports whether key is in the range from key to end as
+// etcd understands it.
+func inRange(k string, key, end []byte) bool {
+	switch {
+	case len(end) == 0:
+		return k == string(key)
+	case bytes.Equal(end, []byte{0}):
+		return k >= string(key)
+	}
+	return k >= string(key) && k < string(end)
+}
+
+// etcd serves the parts of etcd's v3 JSON gateway used by Etcd.
+func (f *fake) etcd(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		var req etcdRange
+		json.NewDecoder(r.Body).Decode(&req)
+		keys, index, _ := f.snapshot(func(k string) bool { return inRange(k, req.Key, req.RangeEnd) })
+
+		resp := etcdRangeResponse{Header: etcdHeader{Revision: int64(index)}}
+		f.mu.Lock()
+		for _, k := range keys {
+			resp.KVs = append(resp.KVs, etcdKV{Key: []byte(k), Value: []byte(f.pairs[k])})
+		}
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(resp)
+
+	case "/v3/watch":
+		var req etcdWatchRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		create := req.CreateRequest
+		match := func(k string) bool { return inRange(k, create.Key, create.RangeEnd) }
+
+		_, index, changed := f.snapshot(match)
+		flusher := w.(http.Flusher)
+		w.Write([]byte(`{"result":{"header":{"revision":"` + strconv.FormatUint(index, 10) + `"},"created":true}}` + "\n"))
+		flusher.Flush()
+		for {
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+			_, index, changed = f.snapshot(match)
+			w.Write([]byte(`{"result":{"header":{"revision":"` + strconv.FormatUint(index, 10) + `"},"events":[{"kv":{}}]}}` + "\n"))
+			flusher.Flush()
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestConsul(t *testing.T) {
+	f := newFake()
+	srv := httptest.NewServer(http.HandlerFunc(f.consul))
+	defer srv.Close()
+
+	if _, err := NewConsul(srv.URL).List("services/app/"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected a permission error, got %v", err)
+	}
+
+	c := NewConsul(srv.URL).WithToken("secret")
+	check(t, c)
+
+	if value, err := c.Get("/services/app/server/tls/cert"); err != nil || string(value) != "/etc/app.pem" {
+		t.Errorf("expected %q, got %q, %v", "/etc/app.pem", value, err)
+	}
+	if _, err := c.Get("/services/app/missing"); err != ErrNotFound {
+		t.Errorf("expected %v, got %v", ErrNotFound, err)
+	}
+
+	watch(t, c, func() { f.put("/services/app/name", "changed") })
+
+	cfg := &Config{}
+	if err := New(c, "/services/app/").Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "changed" {
+		t.Errorf("expected %q, got %q", "changed", cfg.Name)
+	}
+}
+
+func TestEtcd(t *testing.T) {
+	f := newFake()
+	srv := httptest.NewServer(http.HandlerFunc(f.etcd))
+	defer srv.Close()
+
+	e := NewEtcd(srv.URL)
+	check(t, e)
+
+	if value, err := e.Get("/services/app/port"); err != nil || string(value) != "8080" {
+		t.Errorf("expected %q, got %q, %v", "8080", value, err)
+	}
+	if _, err := e.Get("/services/app/missing"); err != ErrNotFound {
+		t.Errorf("expected %v, got %v", ErrNotFound, err)
+	}
+
+	watch(t, e, func() { f.put("/services/app/port", "9090") })
+
+	cfg := &Config{}
+	if err := New(e, "/services/app/").Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 9090 {
+		t.Errorf("expected %d, got %d", 9090, cfg.Port)
+	}
+}
+
+func TestPrefixRange(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		key, end string
+	}{
+		{"", "\x00", "\x00"},
+		{"/app/", "/app/", "/app0"},
+		{"a\xff", "a\xff", "b"},
+		{"\xff\xff", "\xff\xff", "\x00"},
+	}
+
+	for _, test := range tests {
+		key, end := prefixRange(test.prefix)
+		if string(key) != test.key || string(end) != test.end {
+			t.Errorf("%q: expected %q to %q, got %q to %q", test.prefix, test.key, test.end, key, end)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package kv
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Memory is a KVStore held in memory, for tests and for programs
+// that set their configuration themselves. The zero value is an
+// empty store ready to use.
+type Memory struct {
+	mu       sync.Mutex
+	pairs    map[string][]byte
+	watchers map[chan struct{}]string
+}
+
+// NewMemory returns a Memory holding pairs.
+func NewMemory(pairs map[string]string) *Memory {
+	m := &Memory{}
+	for k, v := range pairs {
+		m.Put(k, []byte(v))
+	}
+	return m
+}
+
+// Put sets key to value.
+func (m *Memory) Put(key string, value []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pairs == nil {
+		m.pairs = make(map[string][]byte)
+	}
+	m.pairs[key] = append([]byte(nil), value...)
+	m.notify(key)
+}
+
+// Delete removes key.
+func (m *Memory) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.pairs[key]; ok {
+		delete(m.pairs, key)
+		m.notify(key)
+	}
+}
+
+// notify wakes the watchers of key. A watcher that hasn't caught
+// up with the last change already has one pending.
+func (m *Memory) notify(key string) {
+	for ch, prefix := range m.watchers {
+		if strings.HasPrefix(key, prefix) {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Get implements KVStore.
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.pairs[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// List implements KVStore. Pairs are sorted by key.
+func (m *Memory) List(prefix string) ([]Pair, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pairs []Pair
+	for k, v := range m.pairs {
+		if strings.HasPrefix(k, prefix) {
+			pairs = append(pairs, Pair{Key: k, Value: append([]byte(nil), v...)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	return pairs, nil
+}
+
+// Watch implements KVStore. Changes made while fn is running are
+// reported once it returns.
+func (m *Memory) Watch(ctx context.Context, prefix string, fn func(error)) error {
+	ch := make(chan struct{}, 1)
+	m.mu.Lock()
+	if m.watchers == nil {
+		m.watchers = make(map[chan struct{}]string)
+	}
+	m.watchers[ch] = prefix
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.watchers, ch)
+		m.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+			fn(nil)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Package naming converts Go field names into the names a source
+// uses for them. Providers use a Strategy for fields that haven't
+// been given a name by a tag, so a single struct can be configured
+// by APP_PROXY_ADDR, --proxy-addr and proxy_addr from one field
+// called ProxyAddr.
+package naming
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Strategy converts a name made up of one or more words, such as
+// a field name or a prefix and a field name joined by a separator,
+// into the name a source uses.
+type Strategy func(name string) string
+
+var (
+	// Snake produces proxy_addr.
+	Snake Strategy = func(name string) string {
+		return strings.ToLower(strings.Join(Words(name), "_"))
+	}
+	// ScreamingSnake produces PROXY_ADDR.
+	ScreamingSnake Strategy = func(name string) string {
+		return strings.ToUpper(strings.Join(Words(name), "_"))
+	}
+	// Kebab produces proxy-addr.
+	Kebab Strategy = func(name string) string {
+		return strings.ToLower(strings.Join(Words(name), "-"))
+	}
+	// Camel produces proxyAddr.
+	Camel Strategy = func(name string) string {
+		words := Words(name)
+		for i, w := range words {
+			w = strings.ToLower(w)
+			if i > 0 && w != "" {
+				w = strings.ToUpper(w[:1]) + w[1:]
+			}
+			words[i] = w
+		}
+		return strings.Join(words, "")
+	}
+)
+
+// Words splits name into words at underscores, hyphens, dots and
+// spaces, and where the case changes. A run of capitals is a single
+// word, so BaseURLPart is Base, URL and Part.
+func Words(name string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+	}
+
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || r == '.' || unicode.IsSpace(r):
+			flush()
+			continue
+		case unicode.IsUpper(r) && i > 0:
+			prev := runes[i-1]
+			next := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && next) {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
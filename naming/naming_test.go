@@ -0,0 +1,30 @@
+package naming
+
+import "testing"
+
+func TestStrategies(t *testing.T) {
+	tests := []struct {
+		in                           string
+		snake, screaming, kebab, cam string
+	}{
+		{"ProxyAddr", "proxy_addr", "PROXY_ADDR", "proxy-addr", "proxyAddr"},
+		{"BaseURLPart", "base_url_part", "BASE_URL_PART", "base-url-part", "baseUrlPart"},
+		{"transactionID", "transaction_id", "TRANSACTION_ID", "transaction-id", "transactionId"},
+		{"app_Server-listen_addr", "app_server_listen_addr", "APP_SERVER_LISTEN_ADDR", "app-server-listen-addr", "appServerListenAddr"},
+	}
+
+	for _, test := range tests {
+		if out := Snake(test.in); out != test.snake {
+			t.Errorf("%s: expected '%s', got '%s'", test.in, test.snake, out)
+		}
+		if out := ScreamingSnake(test.in); out != test.screaming {
+			t.Errorf("%s: expected '%s', got '%s'", test.in, test.screaming, out)
+		}
+		if out := Kebab(test.in); out != test.kebab {
+			t.Errorf("%s: expected '%s', got '%s'", test.in, test.kebab, out)
+		}
+		if out := Camel(test.in); out != test.cam {
+			t.Errorf("%s: expected '%s', got '%s'", test.in, test.cam, out)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ande980/config/internal/term"
+	"github.com/ande980/config/internal/walk"
+)
+
+// Prompt makes Parse ask for the value of every field with a prompt
+// tag, such as prompt:"Database password", that is still unset once
+// the providers have run. Questions are written to standard error
+// and answers read from standard input, and nothing is asked unless
+// standard input is a terminal. Input is hidden for fields tagged
+// secret:"true", and fields with a oneof tag are offered as a list
+// of choices.
+func Prompt() Option {
+	return func(o *options) {
+		if term.IsTerminal(os.Stdin.Fd()) {
+			o.promptIn, o.promptOut = os.Stdin, os.Stderr
+		}
+	}
+}
+
+// PromptWith is Prompt reading answers from r and writing questions
+// to w, whether or not r is a terminal. Secrets are only hidden if r
+// is a terminal.
+func PromptWith(r io.Reader, w io.Writer) Option {
+	return func(o *options) {
+		o.promptIn, o.promptOut = r, w
+	}
+}
+
+// prompter asks for values on out and reads the answers from in.
+type prompter struct {
+	in  io.Reader
+	r   *bufio.Reader
+	out io.Writer
+	eof bool
+}
+
+// prompt asks for the unset fields of v, a struct, that have a
+// prompt tag. Answers that can't be used are asked for again. Once
+// in is exhausted the remaining fields are left alone.
+func prompt(v reflect.Value, in io.Reader, out io.Writer) error {
+	p := &prompter{in: in, r: bufio.NewReader(in), out: out}
+	var result Errors
+	p.visit(v, "", &result)
+	return result.ErrorOrNil()
+}
+
+func (p *prompter) visit(v reflect.Value, path string, result *Errors) {
+	t := v.Type()
+	for i := 0; i < t.NumField() && !p.eof; i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		fieldPath := f.Name
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+
+		field := v.Field(i)
+		if f.Tag.Get("prompt") == "" {
+			field = reflect.Indirect(field)
+			if field.Kind() == reflect.Struct {
+				p.visit(field, fieldPath, result)
+			}
+			continue
+		}
+
+		if !field.IsZero() || !field.CanSet() {
+			continue
+		}
+		if err := p.ask(f, field); err != nil {
+			*result = result.Append(&FieldError{Path: fieldPath, Source: "prompt", Err: err})
+			return
+		}
+	}
+}
+
+// ask asks for the value of field until it gets one that can be
+// used, or an empty answer if the field isn't required.
+func (p *prompter) ask(f reflect.StructField, field reflect.Value) error {
+	target := field
+	if field.Kind() == reflect.Ptr {
+		target = reflect.New(field.Type().Elem()).Elem()
+	}
+
+	question := f.Tag.Get("prompt")
+	choices := strings.Fields(f.Tag.Get("oneof"))
+	secret, _ := strconv.ParseBool(f.Tag.Get("secret"))
+	required := false
+	for _, r := range rules(f.Tag) {
+		required = required || r.name == "required"
+	}
+
+	for {
+		if len(choices) > 0 {
+			fmt.Fprintf(p.out, "%s:\n", question)
+			for n, choice := range choices {
+				fmt.Fprintf(p.out, "  %d) %s\n", n+1, choice)
+			}
+			fmt.Fprintf(p.out, "Choose 1-%d: ", len(choices))
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+
+		answer, err := p.read(secret)
+		if err == io.EOF {
+			p.eof = true
+			fmt.Fprintln(p.out)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if answer == "" {
+			if required {
+				fmt.Fprintln(p.out, "A value is required.")
+				continue
+			}
+			return nil
+		}
+
+		if len(choices) > 0 {
+			if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(choices) {
+				answer = choices[n-1]
+			} else if !contains(choices, answer) {
+				fmt.Fprintf(p.out, "%q is not one of the choices.\n", answer)
+				continue
+			}
+		}
+
+		if err := walk.Set(target, answer); err != nil {
+			fmt.Fprintf(p.out, "%v\n", err)
+			continue
+		}
+		if field.Kind() == reflect.Ptr {
+			field.Set(target.Addr())
+		}
+		return nil
+	}
+}
+
+// read reads a line, without echoing it if secret is true and the
+// input is a terminal.
+func (p *prompter) read(secret bool) (string, error) {
+	if f, ok := p.in.(*os.File); ok && secret && term.IsTerminal(f.Fd()) {
+		if restore, err := term.NoEcho(f.Fd()); err == nil {
+			defer func() {
+				restore()
+				fmt.Fprintln(p.out)
+			}()
+		}
+	}
+
+	line, err := p.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func contains(list []string, s string) bool {
+	for _, elem := range list {
+		if elem == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,276 @@
+package properties
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ande980/config/crypt"
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/internal/expand"
+	"github.com/ande980/config/internal/format"
+	"github.com/ande980/config/internal/walk"
+	"github.com/ande980/config/naming"
+	"github.com/ande980/config/secret"
+)
+
+// Provider is a config provider that reads from a Java
+// .properties file or io.Reader and scans into the specified
+// struct. Dotted keys map onto nested structs so
+// server.tls.cert sets Server.TLS.Cert. Names are matched
+// against the properties tag, then the field name without
+// regard to case.
+type Provider struct {
+	r         io.Reader
+	path      string
+	err       error
+	expand    bool
+	strict    bool
+	resolver  secret.Resolver
+	decrypter crypt.Decrypter
+	naming    naming.Strategy
+}
+
+func init() {
+	format.Register("properties", func(r io.Reader, path string, o format.Options) format.Parser {
+		p := WithReader(r)
+		if path != "" {
+			p = WithPath(path)
+		}
+		p.WithResolver(o.Resolver).WithDecrypter(o.Decrypter).WithNaming(o.Naming)
+		if o.Expand {
+			p.ExpandEnv(o.Strict)
+		}
+		return p
+	})
+}
+
+// New is the default way to create a properties Provider. The
+// entire file is read when New is called and a reader created
+// from the buffer. If there is an error reading the file it
+// is stored in Provider and returned during Parse.
+func New() *Provider {
+	filepathNoExt := strings.TrimSuffix(filepath.Base(os.Args[0]), filepath.Ext(os.Args[0]))
+	return WithPath(filepathNoExt + ".properties")
+}
+
+// WithPath allows for a non-standard configuration file to be
+// specified at runtime. If there is an error reading the file it
+// is stored in Provider and returned during Parse.
+func WithPath(path string) *Provider {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return &Provider{r: strings.NewReader("")} // No-op reader
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	p := &Provider{r: bytes.NewReader(buf), path: path}
+	if err != nil {
+		p.err = fmt.Errorf("reading configuration file: %v", err)
+	}
+	return p
+}
+
+// WithReader accepts a reader and returns a properties Provider.
+func WithReader(r io.Reader) *Provider {
+	return &Provider{r: r}
+}
+
+// ExpandEnv enables ${NAME} and ${NAME:-default} placeholders
+// in the file, which are replaced with environmental variables
+// before parsing. $$ is a literal $. An unset variable with no
+// default expands to nothing unless strict is true, in which
+// case Parse returns an error for each one.
+func (p *Provider) ExpandEnv(strict bool) *Provider {
+	p.expand = true
+	p.strict = strict
+	return p
+}
+
+// WithResolver sets the secret.Resolver that values are passed
+// through before they're stored, such as secret.Default() for
+// file:// references. Without one values are stored as they are.
+func (p *Provider) WithResolver(r secret.Resolver) *Provider {
+	p.resolver = r
+	return p
+}
+
+// WithDecrypter enables decryption of values in the ENC[...]
+// form. See the crypt package.
+func (p *Provider) WithDecrypter(d crypt.Decrypter) *Provider {
+	p.decrypter = d
+	return p
+}
+
+// WithNaming sets the strategy that turns the names of fields
+// without a tag into keys, such as naming.Snake for proxy_addr.
+// By default field names are matched without regard to case.
+func (p *Provider) WithNaming(s naming.Strategy) *Provider {
+	p.naming = s
+	return p
+}
+
+// Parse implements the config.Provider interface. Keys that don't
+// match a field are ignored, as they are by the json, toml and
+// yaml providers.
+func (p *Provider) Parse(i interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	buf, err := ioutil.ReadAll(p.r)
+	if err != nil {
+		return fmt.Errorf("reading configuration: %v", err)
+	}
+
+	var m *expand.Map
+	if p.expand {
+		if buf, m, err = expand.File(buf, p.path, "properties", p.strict); err != nil {
+			return err
+		}
+	}
+
+	entries, err := parse(buf)
+	if err != nil {
+		err.(*errs.FileError).Path = p.path
+		return m.Locate(err)
+	}
+
+	var result errs.Errors
+	for _, e := range entries {
+		var path string
+		value, err := p.value(e.value)
+		if err == nil {
+			path, _, err = walk.Assign(reflect.ValueOf(i), "properties", p.naming, strings.Split(e.key, "."), value)
+		}
+		if err != nil {
+			result = append(result, &errs.FieldError{
+				Path:   path,
+				Source: "properties",
+				Key:    e.key,
+				Value:  e.value,
+				Err:    &errs.FileError{Path: p.path, Format: "properties", Line: e.line, Key: e.key, Err: err},
+			})
+		}
+	}
+	return m.Locate(result.ErrorOrNil())
+}
+
+// value decrypts and resolves s, a value as written in the file.
+func (p *Provider) value(s string) (string, error) {
+	if p.decrypter != nil && crypt.IsEncrypted(s) {
+		var err error
+		if s, err = crypt.DecryptValue(s, p.decrypter); err != nil {
+			return "", err
+		}
+	}
+	if p.resolver != nil {
+		return p.resolver.Resolve(s)
+	}
+	return s, nil
+}
+
+type entry struct {
+	key   string
+	value string
+	line  int
+}
+
+// parse follows the format read by java.util.Properties: lines
+// starting with # or ! are comments, a key ends at the first
+// unescaped =, : or whitespace, a line ending in a backslash is
+// continued on the next and \t, \n, \r, \f and \uXXXX escapes
+// are understood.
+func parse(buf []byte) ([]entry, error) {
+	lines := strings.Split(strings.Replace(string(buf), "\r\n", "\n", -1), "\n")
+
+	var entries []entry
+	for n := 0; n < len(lines); n++ {
+		start := n + 1
+		line := strings.TrimLeft(lines[n], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+
+		for continued(line) && n+1 < len(lines) {
+			n++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[n], " \t\f")
+		}
+
+		end := 0
+		for end < len(line) && !strings.ContainsRune("=: \t\f", rune(line[end])) {
+			if line[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end > len(line) {
+			end = len(line)
+		}
+
+		rest := strings.TrimLeft(line[end:], " \t\f")
+		if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+			rest = strings.TrimLeft(rest[1:], " \t\f")
+		}
+
+		key, err := unescape(line[:end])
+		if err != nil {
+			return nil, &errs.FileError{Format: "properties", Line: start, Err: err}
+		}
+		value, err := unescape(rest)
+		if err != nil {
+			return nil, &errs.FileError{Format: "properties", Line: start, Key: key, Err: err}
+		}
+		entries = append(entries, entry{key, value, start})
+	}
+	return entries, nil
+}
+
+// continued reports whether line ends in an odd number of
+// backslashes.
+func continued(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+func unescape(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(s) {
+				return "", fmt.Errorf("malformed \\u escape")
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("malformed \\u escape: %v", err)
+			}
+			b.WriteRune(rune(r))
+			i += 4
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
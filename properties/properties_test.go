@@ -0,0 +1,114 @@
+package properties
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ande980/config/crypt"
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/secret"
+)
+
+type Config struct {
+	A      string `properties:"abcd"`
+	B      bool
+	C      time.Duration
+	Server *Server
+}
+
+type Server struct {
+	Addr    string
+	Message string
+}
+
+func TestProperties(t *testing.T) {
+	cfg := &Config{A: "test"}
+
+	r := strings.NewReader(`# a comment
+! another comment
+abcd = princes of the universe
+b:true
+c 3h
+server.addr=:9090
+server.message = hello \
+    world\té
+`)
+	if err := WithReader(r).Parse(cfg); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if cfg.A != "princes of the universe" {
+		t.Errorf("expected '%s', got '%s'", "princes of the universe", cfg.A)
+	}
+
+	if !cfg.B {
+		t.Errorf("expected %t, got %t", true, cfg.B)
+	}
+
+	if cfg.C != 3*time.Hour {
+		t.Errorf("expected %s, got %s", 3*time.Hour, cfg.C)
+	}
+
+	if cfg.Server == nil || cfg.Server.Addr != ":9090" {
+		t.Errorf("expected server :9090, got %+v", cfg.Server)
+	}
+
+	if cfg.Server.Message != "hello world\té" {
+		t.Errorf("expected '%s', got '%s'", "hello world\té", cfg.Server.Message)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	err := WithReader(strings.NewReader("a = 1\nb = maybe\n")).Parse(&Config{})
+
+	var fieldErr *errs.FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Path != "B" || fieldErr.Value != "maybe" {
+		t.Errorf("expected a field error for B, got '%v'", err)
+	}
+
+	var fe *errs.FileError
+	if !errors.As(err, &fe) || fe.Line != 2 {
+		t.Errorf("expected an error on line 2, got '%v'", err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	os.Setenv("PROPERTIES_TEST_NAME", "brian")
+	defer os.Unsetenv("PROPERTIES_TEST_NAME")
+
+	key, _ := crypt.GenerateKey()
+	a, _ := crypt.NewAESGCM(key)
+	v, _ := a.Encrypt([]byte("secret://cert"), "str")
+
+	resolver := secret.Schemes{"secret": secret.ResolverFunc(func(s string) (string, error) {
+		return "/etc/" + strings.TrimPrefix(s, "secret://") + ".pem", nil
+	})}
+
+	r := strings.NewReader(`abcd = ${PROPERTIES_TEST_NAME}
+c = ${PROPERTIES_TEST_MISSING:-2h}
+server.addr = ${PROPERTIES_TEST_ADDR}
+server.message = ` + v.String() + "\n")
+	cfg := &Config{}
+	if err := WithReader(r).ExpandEnv(false).WithDecrypter(a).WithResolver(resolver).Parse(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.A != "brian" || cfg.C != 2*time.Hour {
+		t.Errorf("expected 'brian' and %s, got '%s' and %s", 2*time.Hour, cfg.A, cfg.C)
+	}
+	if cfg.Server == nil || cfg.Server.Addr != "" || cfg.Server.Message != "/etc/cert.pem" {
+		t.Errorf("expected an empty address and /etc/cert.pem, got %+v", cfg.Server)
+	}
+
+	r = strings.NewReader("b = true\nabcd = ${PROPERTIES_TEST_MISSING}\n")
+	err := WithReader(r).ExpandEnv(true).Parse(&Config{})
+
+	var fe *errs.FileError
+	if !errors.As(err, &fe) || fe.Line != 2 {
+		t.Errorf("expected an error on line 2, got '%v'", err)
+	}
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ande980/config/internal/walk"
+)
+
+// tags are the struct tags a reference can use to name a field,
+// in addition to the field name itself and its config tag.
+var tags = []string{"json", "yaml", "toml", "hcl"}
+
+var errUnknownReference = errors.New("unknown reference")
+
+// references resolves ${server.host} style placeholders in string
+// fields once every provider has had its turn. A placeholder names
+// another field by its path, matched without regard to case against
+// field names and their config, json, yaml, toml and hcl tags.
+// Referenced fields are resolved first so references can be chained,
+// and cycles are reported rather than followed. A placeholder for a
+// single name that isn't a top level field is left alone as it is
+// more likely to be meant for something else. $${ is a literal ${.
+type references struct {
+	root  reflect.Value
+	state map[string]int
+	stack []string
+}
+
+const (
+	resolving = iota + 1
+	resolved
+)
+
+func resolveReferences(v reflect.Value) error {
+	r := &references{root: v, state: make(map[string]int)}
+
+	var result Errors
+	walk.Strings(v, func(path string, field reflect.Value) {
+		result = result.Append(r.resolve(path, field))
+	})
+	return result.ErrorOrNil()
+}
+
+func (r *references) resolve(path string, field reflect.Value) error {
+	switch r.state[path] {
+	case resolved:
+		return nil
+	case resolving:
+		cycle := append([]string{}, r.stack...)
+		for len(cycle) > 0 && cycle[0] != path {
+			cycle = cycle[1:]
+		}
+		return fmt.Errorf("reference cycle: %s", strings.Join(append(cycle, path), " -> "))
+	}
+
+	r.state[path] = resolving
+	r.stack = append(r.stack, path)
+	defer func() {
+		r.state[path] = resolved
+		r.stack = r.stack[:len(r.stack)-1]
+	}()
+
+	s := field.String()
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.HasPrefix(s[i:], "$${") {
+			b.WriteString("${")
+			i += 2
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+		if !strings.HasPrefix(s[i:], "${") || end < 0 {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		ref := s[i+2 : i+end]
+		target, targetPath, ok := r.lookup(ref)
+		switch {
+		case !ok && !strings.Contains(ref, "."):
+			b.WriteByte(s[i])
+			continue
+		case !ok:
+			return &FieldError{Path: path, Source: "reference", Key: ref, Value: s, Err: errUnknownReference}
+		}
+
+		if target.Kind() == reflect.String && target.CanSet() {
+			if err := r.resolve(targetPath, target); err != nil {
+				if _, ok := err.(*FieldError); ok {
+					return err
+				}
+				return &FieldError{Path: path, Source: "reference", Key: ref, Value: s, Err: err}
+			}
+		}
+		fmt.Fprint(&b, target.Interface())
+		i += end
+	}
+
+	field.SetString(b.String())
+	return nil
+}
+
+// lookup finds the field named by ref and returns it along with
+// its Go path.
+func (r *references) lookup(ref string) (reflect.Value, string, bool) {
+	v := r.root
+	var path []string
+	for _, name := range strings.Split(ref, ".") {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, "", false
+			}
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			fields, ok := fieldByName(v.Type(), name)
+			if !ok {
+				return reflect.Value{}, "", false
+			}
+			for j, f := range fields {
+				if j > 0 {
+					if v = reflect.Indirect(v); !v.IsValid() {
+						return reflect.Value{}, "", false
+					}
+				}
+				v = v.Field(f.Index[0])
+				path = append(path, f.Name)
+			}
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, "", false
+			}
+			v = v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+			if !v.IsValid() {
+				return reflect.Value{}, "", false
+			}
+			path = append(path, name)
+		default:
+			return reflect.Value{}, "", false
+		}
+	}
+
+	v = reflect.Indirect(v)
+	if !v.IsValid() || !v.CanInterface() || v.Kind() == reflect.Struct {
+		return reflect.Value{}, "", false
+	}
+	return v, strings.Join(path, "."), true
+}
+
+// fieldByName finds the field called name in t, looking through
+// flattened structs, and returns the chain of fields leading to it.
+func fieldByName(t reflect.Type, name string) ([]reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if walk.Flatten(f, "") {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if chain, ok := fieldByName(ft, name); ok {
+				return append([]reflect.StructField{f}, chain...), true
+			}
+			continue
+		}
+		if strings.EqualFold(f.Name, name) {
+			return []reflect.StructField{f}, true
+		}
+		if cfg, _ := walk.Config(f); cfg != "" && strings.EqualFold(cfg, name) {
+			return []reflect.StructField{f}, true
+		}
+		for _, tag := range tags {
+			if tagName := strings.Split(f.Tag.Get(tag), ",")[0]; tagName != "" && strings.EqualFold(tagName, name) {
+				return []reflect.StructField{f}, true
+			}
+		}
+	}
+	return nil, false
+}
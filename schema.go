@@ -0,0 +1,571 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	stdjson "encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/internal/format"
+	"github.com/ande980/config/internal/locate"
+	"github.com/ande980/config/internal/schema"
+	"github.com/ande980/config/internal/walk"
+)
+
+// SchemaDraft is the JSON Schema dialect produced by Schema.
+const SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema returns a JSON Schema describing the configuration files
+// that can be decoded into i, a struct or a pointer to one, so that
+// editors and CI can check and complete them. Keys are named as the
+// json provider names them, or the provider of the Format given,
+// including the File naming strategy given by WithNaming. Fields
+// are described by their usage tag and values already set in i are
+// given as defaults. The validation tags become their schema
+// equivalents: validate:"required" marks a field as required, oneof
+// gives an enum, min, max and len give bounds, regexp gives a
+// pattern and validate:"url" the uri format.
+func Schema(i interface{}, opts ...Option) ([]byte, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	v := reflect.ValueOf(i)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v = reflect.Zero(v.Type().Elem())
+		} else {
+			v = v.Elem()
+		}
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, &reflect.ValueError{Method: "config.Schema", Kind: reflect.Struct}
+	}
+
+	return o.document(v, formatTag(o.format), true)
+}
+
+// formatTag returns the struct tag of the format called name, or
+// json if name is empty.
+func formatTag(name string) string {
+	switch name {
+	case "", "jsonc", "json5":
+		return "json"
+	case "yml":
+		return "yaml"
+	}
+	return name
+}
+
+// document encodes the schema describing v, a struct, with keys
+// named by tag. The validation tags become schema keywords only if
+// constraints is true.
+func (o *options) document(v reflect.Value, tag string, constraints bool) ([]byte, error) {
+	s := o.schema(v, tag, constraints, map[reflect.Type]bool{})
+	s["$schema"] = SchemaDraft
+
+	var buf bytes.Buffer
+	enc := stdjson.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// schema describes the type of v as document does. v may be
+// the zero value of its type when there's no value to take defaults
+// from. seen holds the structs being described to stop recursive
+// types.
+func (o *options) schema(v reflect.Value, tag string, constraints bool, seen map[reflect.Type]bool) map[string]interface{} {
+	t := v.Type()
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == durationType:
+		return map[string]interface{}{"type": []string{"string", "integer"}}
+	case reflect.PtrTo(t).Implements(textUnmarshalerType):
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return o.schema(reflect.Zero(t.Elem()), tag, constraints, seen)
+		}
+		return o.schema(v.Elem(), tag, constraints, seen)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": o.schema(reflect.Zero(t.Elem()), tag, constraints, seen)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": o.schema(reflect.Zero(t.Elem()), tag, constraints, seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return map[string]interface{}{"type": "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		s := map[string]interface{}{"type": "object"}
+		properties := map[string]interface{}{}
+		var required []string
+		o.properties(v, tag, constraints, properties, &required, seen)
+		if len(properties) > 0 {
+			s["properties"] = properties
+		}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+	return map[string]interface{}{}
+}
+
+// properties adds the fields of v, a struct, to properties, and
+// the names of the required ones to required.
+func (o *options) properties(v reflect.Value, tag string, constraints bool, properties map[string]interface{}, required *[]string, seen map[reflect.Type]bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		field := v.Field(i)
+		if walk.Flatten(f, tag) {
+			for field.Kind() == reflect.Ptr {
+				if field.IsNil() {
+					field = reflect.Zero(field.Type().Elem())
+					break
+				}
+				field = field.Elem()
+			}
+			o.properties(field, tag, constraints, properties, required, seen)
+			continue
+		}
+
+		name, ok := walk.Key(f, tag, o.naming.File)
+		if !ok {
+			continue
+		}
+
+		s := o.schema(field, tag, constraints, seen)
+		if usage := f.Tag.Get("usage"); usage != "" {
+			s["description"] = usage
+		}
+		if def, ok := defaultValue(field); ok {
+			s["default"] = def
+		}
+		for _, r := range rules(f.Tag) {
+			switch {
+			case !constraints:
+			case r.name == "required":
+				*required = append(*required, name)
+			default:
+				r.schema(field.Type(), s)
+			}
+		}
+		properties[name] = s
+	}
+}
+
+// schema adds the JSON Schema equivalent of r, if there is one, to
+// s, the schema of a field of type t.
+func (r rule) schema(t reflect.Type, s map[string]interface{}) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch r.name {
+	case "min", "max", "len":
+		n, err := strconv.ParseFloat(r.arg, 64)
+		if err != nil {
+			return
+		}
+		var min, max string
+		switch t.Kind() {
+		case reflect.String:
+			min, max = "minLength", "maxLength"
+		case reflect.Slice, reflect.Array:
+			min, max = "minItems", "maxItems"
+		case reflect.Map:
+			min, max = "minProperties", "maxProperties"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			if t == durationType || r.name == "len" {
+				return
+			}
+			min, max = "minimum", "maximum"
+		default:
+			return
+		}
+		if r.name != "max" {
+			s[min] = n
+		}
+		if r.name != "min" {
+			s[max] = n
+		}
+	case "oneof":
+		var enum []interface{}
+		for _, value := range strings.Fields(r.arg) {
+			enum = append(enum, enumValue(t, value))
+		}
+		s["enum"] = enum
+	case "regexp":
+		s["pattern"] = r.arg
+	case "url":
+		s["format"] = "uri"
+	}
+}
+
+// enumValue converts value, one of the values of a oneof rule, to
+// the type of the field so it matches the values in a file.
+func enumValue(t reflect.Type, value string) interface{} {
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t == durationType {
+			break
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+// defaultValue returns the value of v to use as a default if it's
+// set and can be written in a file as it is.
+func defaultValue(v reflect.Value) (interface{}, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if v.IsZero() {
+		return nil, false
+	}
+	return literal(v)
+}
+
+// literal returns v as a value that can be encoded as JSON, or
+// false if it's a struct, map or interface.
+func literal(v reflect.Value) (interface{}, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String(), true
+	case v.Type() == timeType:
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), true
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		return string(text), err == nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return v.Interface(), true
+	case reflect.Slice, reflect.Array:
+		var list []interface{}
+		for i := 0; i < v.Len(); i++ {
+			elem, ok := literal(v.Index(i))
+			if !ok {
+				return nil, false
+			}
+			list = append(list, elem)
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+// validateSchema checks the configuration in v, a struct, against
+// the schema given to ValidateSchema. The values set in v are laid
+// over the documents in files, the configuration files Parse read,
+// so that values set to zero in a file and keys no field reads are
+// checked too. Values that don't match are looked for in files to
+// give their position. Keys are named by the tag of the first file
+// that exists, or of the Format given.
+func (o *options) validateSchema(v reflect.Value, files []string) error {
+	name := o.format
+	for _, path := range files {
+		if _, err := os.Stat(path); err == nil {
+			name = strings.TrimPrefix(filepath.Ext(path), ".")
+			break
+		}
+	}
+	tag := formatTag(name)
+
+	buf := o.schemaBuf
+	switch {
+	case o.schemaAt != "":
+		b, err := ioutil.ReadFile(o.schemaAt)
+		if err != nil {
+			return fmt.Errorf("reading schema: %v", err)
+		}
+		buf = b
+	case buf == nil:
+		// If the rules are checked by validateRules they're left out
+		// rather than reported twice.
+		b, err := o.document(v, tag, !o.rules)
+		if err != nil {
+			return err
+		}
+		buf = b
+	}
+
+	s, err := schema.Parse(buf)
+	if err != nil {
+		return err
+	}
+
+	var tree interface{} = map[string]interface{}{}
+	for _, path := range files {
+		if doc, ok := o.decoded(path); ok {
+			tree = overlay(tree, doc)
+		}
+	}
+	if set, ok := o.tree(v, tag); ok {
+		tree = overlay(tree, set)
+	}
+
+	var contents [][]byte
+	for _, path := range files {
+		b, _ := ioutil.ReadFile(path)
+		contents = append(contents, b)
+	}
+
+	var result Errors
+	for _, e := range schema.Validate(s, tree) {
+		se := &SchemaError{Pointer: e.Pointer(), Keyword: e.Keyword, Value: e.Value, Err: e.Err}
+		for n, path := range files {
+			if span, ok := locateKeys(path, contents[n], e.Keys); ok {
+				se.File = path
+				se.Line, se.Column = errs.Position(contents[n], int64(span.Start))
+				break
+			}
+		}
+		result = append(result, se)
+	}
+	return result.ErrorOrNil()
+}
+
+// decoded returns the document in the file at path as its provider
+// decodes it, for the formats whose values have types of their own.
+// Secrets aren't resolved a second time.
+func (o *options) decoded(path string) (interface{}, bool) {
+	switch filepath.Ext(path) {
+	case ".json", ".jsonc", ".json5", ".yaml", ".yml", ".toml":
+	default:
+		return nil, false
+	}
+	fn := format.Lookup(strings.TrimPrefix(filepath.Ext(path), "."))
+	if _, err := os.Stat(path); err != nil || fn == nil {
+		return nil, false
+	}
+
+	opts := o.fileOptions()
+	opts.Resolver = nil
+	var doc map[string]interface{}
+	if err := fn(nil, path, opts).Parse(&doc); err != nil {
+		return nil, false
+	}
+	return plain(doc), true
+}
+
+// plain replaces the dates in node, a decoded document, with the
+// strings the struct's values are given as.
+func plain(node interface{}) interface{} {
+	switch n := node.(type) {
+	case time.Time:
+		return n.Format(time.RFC3339Nano)
+	case map[string]interface{}:
+		for k, elem := range n {
+			n[k] = plain(elem)
+		}
+	case []interface{}:
+		for i, elem := range n {
+			n[i] = plain(elem)
+		}
+	}
+	return node
+}
+
+// overlay lays top over base, merging maps key by key. A key in top
+// replaces one in base that differs only in case, as both name the
+// same field.
+func overlay(base, top interface{}) interface{} {
+	bm, ok := base.(map[string]interface{})
+	tm, ok2 := top.(map[string]interface{})
+	if !ok || !ok2 {
+		return top
+	}
+
+	m := make(map[string]interface{}, len(bm)+len(tm))
+	for k, elem := range bm {
+		m[k] = elem
+	}
+	for k, elem := range tm {
+		if _, ok := m[k]; !ok {
+			for existing := range m {
+				if strings.EqualFold(existing, k) {
+					m[k] = m[existing]
+					delete(m, existing)
+					break
+				}
+			}
+		}
+		m[k] = overlay(m[k], elem)
+	}
+	return m
+}
+
+// locateKeys finds the value at keys in buf, the contents of the
+// file at path, if its format can be searched.
+func locateKeys(path string, buf []byte, keys []string) (locate.Span, bool) {
+	if len(buf) == 0 || len(keys) == 0 {
+		return locate.Span{}, false
+	}
+	switch filepath.Ext(path) {
+	case ".json", ".jsonc", ".json5":
+		return locate.JSON(buf, keys)
+	case ".yaml", ".yml":
+		return locate.YAML(buf, keys)
+	case ".toml":
+		return locate.TOML(buf, keys)
+	}
+	return locate.Span{}, false
+}
+
+// tree converts v into the tree of maps, slices and scalars a file
+// would decode into, naming keys by tag as Schema does. Fields left at
+// their zero value are left out, as are structs with no fields
+// set, so a required field must have been set by a provider or
+// appear in a configuration file.
+func (o *options) tree(v reflect.Value, tag string) (interface{}, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Struct && v.Type() != timeType {
+		if _, ok := v.Interface().(encoding.TextMarshaler); !ok {
+			m := map[string]interface{}{}
+			o.fields(v, tag, m)
+			return m, len(m) > 0
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		m := map[string]interface{}{}
+		for _, key := range v.MapKeys() {
+			if elem, ok := o.tree(v.MapIndex(key), tag); ok {
+				m[fmt.Sprint(key)] = elem
+			} else {
+				m[fmt.Sprint(key)] = nil
+			}
+		}
+		return m, true
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i], _ = o.tree(v.Index(i), tag)
+		}
+		return list, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			return time.Duration(v.Int()).String(), true
+		}
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Bool:
+		return v.Bool(), true
+	case reflect.String:
+		return v.String(), true
+	}
+	return literal(v)
+}
+
+// fields adds the fields of v, a struct, that have been set to m.
+func (o *options) fields(v reflect.Value, tag string, m map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		field := v.Field(i)
+		if walk.Flatten(f, tag) {
+			if sub, ok := o.tree(field, tag); ok {
+				sm, _ := sub.(map[string]interface{})
+				for k, elem := range sm {
+					m[k] = elem
+				}
+			}
+			continue
+		}
+
+		name, ok := walk.Key(f, tag, o.naming.File)
+		if !ok || field.IsZero() {
+			continue
+		}
+		if elem, ok := o.tree(field, tag); ok {
+			m[name] = elem
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package secret resolves configuration values that refer to a
+// secret, such as file:///run/secrets/db_password, to the secret
+// itself. Providers given a Resolver pass the string values they
+// read through it, which config.WithSecretResolver arranges for
+// the providers Parse uses.
+package secret
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/internal/walk"
+)
+
+// Resolver returns the secret that value refers to, or value
+// unchanged if it isn't a reference the Resolver understands.
+type Resolver interface {
+	Resolve(value string) (string, error)
+}
+
+// ResolverFunc is a convenience type a la http.HandlerFunc.
+type ResolverFunc func(string) (string, error)
+
+// Resolve allows ResolverFunc to satisfy the Resolver interface.
+func (f ResolverFunc) Resolve(value string) (string, error) {
+	return f(value)
+}
+
+// Schemes is a Resolver that hands values of the form
+// scheme://reference to the Resolver registered for the scheme,
+// e.g. Schemes{"file": Files, "vault": myVault}. Anything else is
+// returned unchanged.
+type Schemes map[string]Resolver
+
+// Resolve implements the Resolver interface.
+func (s Schemes) Resolve(value string) (string, error) {
+	idx := strings.Index(value, "://")
+	if idx <= 0 {
+		return value, nil
+	}
+
+	r, ok := s[value[:idx]]
+	if !ok {
+		return value, nil
+	}
+	return r.Resolve(value)
+}
+
+// Files resolves file:// references to the contents of the file
+// with any trailing newline removed, which is how Docker and
+// Kubernetes mount secrets. file:///run/secrets/x is absolute and
+// file://secrets/x is relative to the working directory.
+var Files Resolver = ResolverFunc(func(value string) (string, error) {
+	if !strings.HasPrefix(value, "file://") {
+		return value, nil
+	}
+
+	buf, err := ioutil.ReadFile(strings.TrimPrefix(value, "file://"))
+	if err != nil {
+		return "", fmt.Errorf("reading secret: %v", err)
+	}
+	return strings.TrimRight(string(buf), "\r\n"), nil
+})
+
+// Default returns the Resolver used when none is specified, which
+// only understands file:// references.
+func Default() Schemes {
+	return Schemes{"file": Files}
+}
+
+// Struct passes every string field in i, a pointer to a struct,
+// through r and stores the result. Failures are returned as a
+// list of field errors.
+func Struct(i interface{}, r Resolver) error {
+	var result errs.Errors
+	walk.Strings(reflect.ValueOf(i), func(path string, field reflect.Value) {
+		val, err := r.Resolve(field.String())
+		if err != nil {
+			result = append(result, &errs.FieldError{Path: path, Source: "secret", Value: field.String(), Err: err})
+			return
+		}
+		field.SetString(val)
+	})
+	return result.ErrorOrNil()
+}
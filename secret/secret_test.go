@@ -0,0 +1,76 @@
+package secret
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ande980/config/internal/errs"
+)
+
+type Config struct {
+	Password string
+	Token    string
+	Plain    string
+	Server   *Server
+}
+
+type Server struct {
+	Key string
+}
+
+func TestStruct(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(path, []byte("hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	vault := ResolverFunc(func(value string) (string, error) {
+		if value == "vault://secret/token" {
+			return "s3cr3t", nil
+		}
+		return "", errors.New("not found")
+	})
+
+	cfg := &Config{
+		Password: "file://" + path,
+		Token:    "vault://secret/token",
+		Plain:    "https://example.com",
+		Server:   &Server{Key: "file://" + path},
+	}
+
+	r := Default()
+	r["vault"] = vault
+	if err := Struct(cfg, r); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	expected := []string{"hunter2", "s3cr3t", "https://example.com", "hunter2"}
+	for i, got := range []string{cfg.Password, cfg.Token, cfg.Plain, cfg.Server.Key} {
+		if got != expected[i] {
+			t.Errorf("expected '%s', got '%s'", expected[i], got)
+		}
+	}
+
+	cfg = &Config{Token: "vault://secret/missing", Plain: "file://" + filepath.Join(dir, "missing")}
+	err = Struct(cfg, r)
+
+	list, ok := err.(errs.Errors)
+	if !ok || len(list) != 2 {
+		t.Fatalf("expected 2 errors, got '%v'", err)
+	}
+
+	var fe *errs.FieldError
+	if !errors.As(list[0], &fe) || fe.Path != "Token" || fe.Value != "vault://secret/missing" {
+		t.Errorf("expected a field error for Token, got '%v'", list[0])
+	}
+}
@@ -7,16 +7,46 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/BurntSushi/toml"
+	"github.com/ande980/config/crypt"
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/internal/expand"
+	"github.com/ande980/config/internal/format"
+	"github.com/ande980/config/internal/walk"
+	"github.com/ande980/config/naming"
+	"github.com/ande980/config/secret"
 )
 
 // Provider is a config provider that reads from a toml
 // file or io.Reader and scans into the specified struct.
 type Provider struct {
-	r   io.Reader
-	err error
+	r         io.Reader
+	path      string
+	err       error
+	expand    bool
+	strict    bool
+	resolver  secret.Resolver
+	decrypter crypt.Decrypter
+	naming    naming.Strategy
+}
+
+func init() {
+	format.Register("toml", func(r io.Reader, path string, o format.Options) format.Parser {
+		p := WithReader(r)
+		if path != "" {
+			p = WithPath(path)
+		}
+		p.WithResolver(o.Resolver).WithDecrypter(o.Decrypter).WithNaming(o.Naming)
+		if o.Expand {
+			p.ExpandEnv(o.Strict)
+		}
+		return p
+	})
 }
 
 // New is the default way to create a toml Provider. The entire
@@ -33,11 +63,11 @@ func New() *Provider {
 // is stored in Provider and returned during Parse.
 func WithPath(path string) *Provider {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return &Provider{strings.NewReader(""), nil} // No-op reader, but one that doesn't generate io.EOF
+		return &Provider{r: strings.NewReader("")} // No-op reader, but one that doesn't generate io.EOF
 	}
 
 	buf, err := ioutil.ReadFile(path)
-	p := &Provider{r: bytes.NewReader(buf)}
+	p := &Provider{r: bytes.NewReader(buf), path: path}
 	if err != nil {
 		p.err = fmt.Errorf("reading configuration file: %v", err)
 	}
@@ -46,18 +76,148 @@ func WithPath(path string) *Provider {
 
 // WithReader accepts a reader and returns a toml Provider.
 func WithReader(r io.Reader) *Provider {
-	return &Provider{r, nil}
+	return &Provider{r: r}
+}
+
+// ExpandEnv enables ${NAME} and ${NAME:-default} placeholders
+// in the file, which are replaced with environmental variables
+// before decoding. $$ is a literal $. An unset variable with no
+// default expands to nothing unless strict is true, in which
+// case Parse returns an error for each one. Values are inserted
+// as they are so they must be valid TOML where they're used.
+func (p *Provider) ExpandEnv(strict bool) *Provider {
+	p.expand = true
+	p.strict = strict
+	return p
 }
 
-// Parse implements the config.Provider interface.
+// WithResolver sets the secret.Resolver that string values are
+// passed through as they are decoded, such as secret.Default() for
+// file:// references. Without one values are stored as they are.
+func (p *Provider) WithResolver(r secret.Resolver) *Provider {
+	p.resolver = r
+	return p
+}
+
+// WithDecrypter enables decryption of ENC[...] values in the
+// file before decoding. See the crypt package.
+func (p *Provider) WithDecrypter(d crypt.Decrypter) *Provider {
+	p.decrypter = d
+	return p
+}
+
+// WithNaming sets the strategy that turns the names of fields
+// without a tag into keys, such as naming.Snake for proxy_addr.
+// By default field names are matched without regard to case.
+func (p *Provider) WithNaming(s naming.Strategy) *Provider {
+	p.naming = s
+	return p
+}
+
+// Parse implements the config.Provider interface. Decoding
+// errors are returned as a *errs.FileError (config.FileError)
+// locating the problem in the file.
 func (p *Provider) Parse(i interface{}) error {
 	if p.err != nil {
 		return p.err
 	}
 
-	if _, err := toml.DecodeReader(p.r, i); err != nil && err != io.EOF {
-		return fmt.Errorf("decoding toml file: %v", err)
+	buf, err := ioutil.ReadAll(p.r)
+	if err != nil {
+		return fmt.Errorf("reading configuration: %v", err)
+	}
+
+	var m *expand.Map
+	if p.expand {
+		if buf, m, err = expand.File(buf, p.path, "toml", p.strict); err != nil {
+			return err
+		}
+	}
+
+	if p.decrypter != nil {
+		decrypted, err := crypt.Decrypt(buf, p.decrypter)
+		if err != nil {
+			return m.Locate(p.fileError(buf, err))
+		}
+		buf = decrypted
 	}
 
-	return nil
+	var tree map[string]interface{}
+	if _, err := toml.Decode(string(buf), &tree); err != nil && err != io.EOF {
+		return m.Locate(p.fileError(buf, err))
+	}
+
+	return m.Locate(p.bind(buf, i, tree))
+}
+
+var nearRe = regexp.MustCompile(`^Near line (\d+) \(last key parsed '([^']*)'\): `)
+
+// fileError locates err in the file. Syntax errors carry a line
+// number and the last key parsed.
+func (p *Provider) fileError(buf []byte, err error) error {
+	fe := &errs.FileError{Path: p.path, Format: "toml", Err: err}
+	if e, ok := err.(*crypt.Error); ok {
+		fe.Line, fe.Column = errs.Position(buf, int64(e.Offset))
+		return fe
+	}
+
+	if m := nearRe.FindStringSubmatch(err.Error()); m != nil {
+		fe.Line, _ = strconv.Atoi(m[1])
+		fe.Key = m[2]
+		fe.Err = fmt.Errorf("%s", strings.TrimPrefix(err.Error(), m[0]))
+	}
+	return fe
+}
+
+// bind stores the decoded tree in i. Fields are named by their
+// toml tag, config tag or field name, and values that can't be
+// stored are reported as FieldErrors located in the file.
+func (p *Provider) bind(buf []byte, i interface{}, tree map[string]interface{}) error {
+	b := &walk.Binder{Tag: "toml", Naming: p.naming, Custom: custom}
+	if p.resolver != nil {
+		b.Resolve = p.resolver.Resolve
+	}
+
+	var result errs.Errors
+	for _, e := range b.Bind(reflect.ValueOf(i), tree) {
+		key := strings.Join(e.Keys, ".")
+		fe := &errs.FileError{Path: p.path, Format: "toml", Key: key, Err: e.Err}
+		fe.Line, fe.Column = keyLine(buf, e.Keys)
+		result = append(result, &errs.FieldError{Path: e.Path, Source: "toml", Key: key, Value: e.Value, Err: fe})
+	}
+	return result.ErrorOrNil()
+}
+
+// custom hands values to types that decode TOML themselves.
+func custom(node, ptr interface{}) (bool, error) {
+	u, ok := ptr.(toml.Unmarshaler)
+	if !ok {
+		return false, nil
+	}
+	return true, u.UnmarshalTOML(node)
+}
+
+// keyLine finds the line that key is assigned on by tracking
+// the table headers above it.
+func keyLine(buf []byte, key []string) (int, int) {
+	table := ""
+	for n, line := range strings.Split(string(buf), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			table = strings.Trim(trimmed, "[] ")
+			continue
+		}
+		idx := strings.Index(trimmed, "=")
+		if idx <= 0 {
+			continue
+		}
+		name := strings.Trim(strings.TrimSpace(trimmed[:idx]), `"'`)
+		if table != "" {
+			name = table + "." + name
+		}
+		if name == strings.Join(key, ".") {
+			return n + 1, len(line) - len(strings.TrimLeft(line, " \t")) + 1
+		}
+	}
+	return 0, 0
 }
@@ -1,9 +1,12 @@
 package toml
 
 import (
+	"errors"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/ande980/config/internal/errs"
 )
 
 type Config struct {
@@ -71,3 +74,39 @@ func TestNoFile(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestFileError(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		line int
+		col  int
+		key  string
+		path string
+	}{
+		{
+			"syntax", "abcd = \"x\"\nB = false\nC = \n", 3, 0, "C", "",
+		},
+		{
+			"type", "abcd = \"x\"\n\n[Server]\n  Addr = 9090\n", 4, 3, "Server.Addr", "Server.Addr",
+		},
+	}
+
+	for _, test := range tests {
+		err := WithReader(strings.NewReader(test.in)).Parse(&Config{})
+		var fe *errs.FileError
+		if !errors.As(err, &fe) {
+			t.Errorf("%s: expected *errs.FileError, got %T", test.name, err)
+			continue
+		}
+
+		var fieldErr *errs.FieldError
+		if errors.As(err, &fieldErr) != (test.path != "") || (fieldErr != nil && fieldErr.Path != test.path) {
+			t.Errorf("%s: expected field '%s', got %v", test.name, test.path, fieldErr)
+		}
+
+		if fe.Format != "toml" || fe.Line != test.line || fe.Column != test.col || fe.Key != test.key {
+			t.Errorf("%s: expected toml %d:%d '%s', got %s %d:%d '%s'", test.name, test.line, test.col, test.key, fe.Format, fe.Line, fe.Column, fe.Key)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validateRules checks every field against the rules in its tags
+// once the providers have run, if ValidateRules was given:
+//
+//	min:"1" max:"65535"   bounds for numbers and durations, or lengths
+//	len:"3"               exact length of a string, slice or map
+//	oneof:"debug info"    one of the space separated values
+//	regexp:"^[a-z]+$"     a string matching the expression
+//	validate:"required,url,hostport,file-exists,dir-exists"
+//
+// Empty strings only break required, min and len so optional
+// values can be left unset. Nested structs, and structs in slices
+// and maps, are checked too. Every broken rule is reported. Other
+// entries in validate tags, such as those meant for another
+// validation package, are ignored.
+func validateRules(v reflect.Value) error {
+	var result Errors
+	visitRules(v, "", &result)
+	return result.ErrorOrNil()
+}
+
+func visitRules(v reflect.Value, path string, result *Errors) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			visitRules(v.Index(i), fmt.Sprintf("%s.%d", path, i), result)
+		}
+		return
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, key := range keys {
+			visitRules(v.MapIndex(key), fmt.Sprintf("%s.%v", path, key), result)
+		}
+		return
+	case reflect.Struct:
+	default:
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		fieldPath := f.Name
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+
+		field := v.Field(i)
+		for _, rule := range rules(f.Tag) {
+			if err := rule.check(field); err != nil {
+				*result = result.Append(&RuleError{Path: fieldPath, Rule: rule.String(), Value: display(field), Err: err})
+			}
+		}
+
+		if field.Type() != reflect.TypeOf(time.Time{}) {
+			visitRules(field, fieldPath, result)
+		}
+	}
+}
+
+// rule is a single validation rule read from a struct tag.
+type rule struct {
+	name string
+	arg  string
+}
+
+func (r rule) String() string {
+	if r.arg == "" {
+		return r.name
+	}
+	return r.name + "=" + r.arg
+}
+
+// rules returns the rules in tag in a fixed order.
+func rules(tag reflect.StructTag) []rule {
+	var list []rule
+	for _, name := range []string{"min", "max", "len", "oneof", "regexp"} {
+		if arg, ok := tag.Lookup(name); ok {
+			list = append(list, rule{name: name, arg: arg})
+		}
+	}
+	for _, name := range strings.Split(tag.Get("validate"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			list = append(list, rule{name: name})
+		}
+	}
+	return list
+}
+
+var errRequired = errors.New("a value is required")
+
+func (r rule) check(v reflect.Value) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			if r.name == "required" {
+				return errRequired
+			}
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.String && v.Len() == 0 {
+		switch r.name {
+		case "required", "min", "len":
+		default:
+			return nil
+		}
+	}
+
+	switch r.name {
+	case "required":
+		if v.IsZero() {
+			return errRequired
+		}
+	case "min", "max":
+		return r.bound(v)
+	case "len":
+		n, err := strconv.Atoi(r.arg)
+		if err != nil {
+			return fmt.Errorf("invalid rule: %v", err)
+		}
+		l, ok := length(v)
+		if !ok {
+			return fmt.Errorf("invalid rule: %s has no length", v.Type())
+		}
+		if l != n {
+			return fmt.Errorf("length is %d, not %d", l, n)
+		}
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, allowed := range strings.Fields(r.arg) {
+			if s == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %s", s, strings.Join(strings.Fields(r.arg), ", "))
+	case "regexp":
+		re, err := regexp.Compile(r.arg)
+		if err != nil {
+			return fmt.Errorf("invalid rule: %v", err)
+		}
+		if v.Kind() != reflect.String {
+			return fmt.Errorf("invalid rule: %s is not a string", v.Type())
+		}
+		if !re.MatchString(v.String()) {
+			return fmt.Errorf("%q does not match", v.String())
+		}
+	case "url", "hostport", "file-exists", "dir-exists":
+		if v.Kind() != reflect.String {
+			return fmt.Errorf("invalid rule: %s is not a string", v.Type())
+		}
+		return checkString(r.name, v.String())
+	}
+	return nil
+}
+
+// bound checks a min or max rule. Numbers are compared by value,
+// durations parsed from the rule, and anything else by length.
+func (r rule) bound(v reflect.Value) error {
+	var val, limit float64
+	var err error
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val = float64(v.Int())
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			var d time.Duration
+			d, err = time.ParseDuration(r.arg)
+			limit = float64(d)
+			break
+		}
+		limit, err = strconv.ParseFloat(r.arg, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		val = float64(v.Uint())
+		limit, err = strconv.ParseFloat(r.arg, 64)
+	case reflect.Float32, reflect.Float64:
+		val = v.Float()
+		limit, err = strconv.ParseFloat(r.arg, 64)
+	default:
+		l, ok := length(v)
+		if !ok {
+			return fmt.Errorf("invalid rule: %s can't be compared", v.Type())
+		}
+		n, err := strconv.Atoi(r.arg)
+		if err != nil {
+			return fmt.Errorf("invalid rule: %v", err)
+		}
+		if r.name == "min" && l < n {
+			return fmt.Errorf("length is %d, less than %d", l, n)
+		}
+		if r.name == "max" && l > n {
+			return fmt.Errorf("length is %d, more than %d", l, n)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("invalid rule: %v", err)
+	}
+
+	if r.name == "min" && val < limit {
+		return fmt.Errorf("%s is less than %s", display(v), r.arg)
+	}
+	if r.name == "max" && val > limit {
+		return fmt.Errorf("%s is more than %s", display(v), r.arg)
+	}
+	return nil
+}
+
+func checkString(name, s string) error {
+	switch name {
+	case "url":
+		u, err := url.Parse(s)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%q is not an absolute URL", s)
+		}
+	case "hostport":
+		_, port, err := net.SplitHostPort(s)
+		if err != nil {
+			return err
+		}
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return fmt.Errorf("%q is not a valid port", port)
+		}
+	case "file-exists", "dir-exists":
+		info, err := os.Stat(s)
+		if err != nil {
+			return err
+		}
+		if name == "file-exists" && info.IsDir() {
+			return fmt.Errorf("%s is a directory", s)
+		}
+		if name == "dir-exists" && !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", s)
+		}
+	}
+	return nil
+}
+
+func length(v reflect.Value) (int, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return len([]rune(v.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len(), true
+	}
+	return 0, false
+}
+
+// display formats the value of v for an error message.
+func display(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if !v.CanInterface() {
+		return ""
+	}
+	return fmt.Sprint(v.Interface())
+}
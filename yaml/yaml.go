@@ -7,16 +7,49 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 
+	"github.com/ande980/config/crypt"
+	"github.com/ande980/config/internal/errs"
+	"github.com/ande980/config/internal/expand"
+	"github.com/ande980/config/internal/format"
+	"github.com/ande980/config/internal/locate"
+	"github.com/ande980/config/internal/walk"
+	"github.com/ande980/config/naming"
+	"github.com/ande980/config/secret"
 	"gopkg.in/yaml.v2"
 )
 
 // Provider is a config provider that reads from a yaml
 // file or io.Reader and scans into the specified struct.
 type Provider struct {
-	r   io.Reader
-	err error
+	r         io.Reader
+	path      string
+	err       error
+	expand    bool
+	strict    bool
+	resolver  secret.Resolver
+	decrypter crypt.Decrypter
+	naming    naming.Strategy
+}
+
+func init() {
+	for _, name := range []string{"yaml", "yml"} {
+		format.Register(name, func(r io.Reader, path string, o format.Options) format.Parser {
+			p := WithReader(r)
+			if path != "" {
+				p = WithPath(path)
+			}
+			p.WithResolver(o.Resolver).WithDecrypter(o.Decrypter).WithNaming(o.Naming)
+			if o.Expand {
+				p.ExpandEnv(o.Strict)
+			}
+			return p
+		})
+	}
 }
 
 // New is the default way to create a yaml Provider. The entire
@@ -33,11 +66,11 @@ func New() *Provider {
 // is stored in Provider and returned during Parse.
 func WithPath(path string) *Provider {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return &Provider{strings.NewReader(""), nil} // No-op reader, but one that doesn't generate io.EOF
+		return &Provider{r: strings.NewReader("")} // No-op reader, but one that doesn't generate io.EOF
 	}
 
 	buf, err := ioutil.ReadFile(path)
-	p := &Provider{r: bytes.NewReader(buf)}
+	p := &Provider{r: bytes.NewReader(buf), path: path}
 	if err != nil {
 		p.err = fmt.Errorf("reading configuration file: %v", err)
 	}
@@ -46,18 +79,171 @@ func WithPath(path string) *Provider {
 
 // WithReader accepts a reader and returns a yaml Provider.
 func WithReader(r io.Reader) *Provider {
-	return &Provider{r, nil}
+	return &Provider{r: r}
 }
 
-// Parse implements the config.Provider interface.
+// ExpandEnv enables ${NAME} and ${NAME:-default} placeholders
+// in the file, which are replaced with environmental variables
+// before decoding. $$ is a literal $. An unset variable with no
+// default expands to nothing unless strict is true, in which
+// case Parse returns an error for each one. Values are inserted
+// as they are so they must be valid YAML where they're used.
+func (p *Provider) ExpandEnv(strict bool) *Provider {
+	p.expand = true
+	p.strict = strict
+	return p
+}
+
+// WithResolver sets the secret.Resolver that string values are
+// passed through as they are decoded, such as secret.Default() for
+// file:// references. Without one values are stored as they are.
+func (p *Provider) WithResolver(r secret.Resolver) *Provider {
+	p.resolver = r
+	return p
+}
+
+// WithDecrypter enables decryption of ENC[...] values in the
+// file before decoding. See the crypt package.
+func (p *Provider) WithDecrypter(d crypt.Decrypter) *Provider {
+	p.decrypter = d
+	return p
+}
+
+// WithNaming sets the strategy that turns the names of fields
+// without a tag into keys, such as naming.Snake for proxy_addr.
+// By default field names are matched without regard to case.
+func (p *Provider) WithNaming(s naming.Strategy) *Provider {
+	p.naming = s
+	return p
+}
+
+// Parse implements the config.Provider interface. Decoding
+// errors are returned as a *errs.FileError (config.FileError)
+// locating the problem in the file.
 func (p *Provider) Parse(i interface{}) error {
 	if p.err != nil {
 		return p.err
 	}
 
-	if err := yaml.NewDecoder(p.r).Decode(i); err != nil && err != io.EOF {
-		return fmt.Errorf("decoding yaml file: %v", err)
+	buf, err := ioutil.ReadAll(p.r)
+	if err != nil {
+		return fmt.Errorf("reading configuration: %v", err)
+	}
+
+	var m *expand.Map
+	if p.expand {
+		if buf, m, err = expand.File(buf, p.path, "yaml", p.strict); err != nil {
+			return err
+		}
+	}
+
+	if p.decrypter != nil {
+		decrypted, err := crypt.Decrypt(buf, p.decrypter)
+		if err != nil {
+			return m.Locate(p.fileError(buf, err))
+		}
+		buf = decrypted
+	}
+
+	var tree interface{}
+	if err := yaml.NewDecoder(bytes.NewReader(buf)).Decode(&tree); err != nil && err != io.EOF {
+		return m.Locate(p.fileError(buf, err))
+	}
+
+	return m.Locate(p.bind(buf, i, tree))
+}
+
+var lineRe = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+
+// fileError converts the decoder's message, which only carries
+// a line number, into a FileError.
+func (p *Provider) fileError(buf []byte, err error) error {
+	fe := &errs.FileError{Path: p.path, Format: "yaml", Err: err}
+	if e, ok := err.(*crypt.Error); ok {
+		fe.Line, fe.Column = errs.Position(buf, int64(e.Offset))
+		return fe
+	}
+
+	if m := lineRe.FindStringSubmatch(err.Error()); m != nil {
+		fe.Line, _ = strconv.Atoi(m[1])
+		fe.Column, fe.Key = keyAt(buf, fe.Line)
+	}
+	return fe
+}
+
+// bind stores the decoded tree in i. Fields are named by their
+// yaml tag, config tag or field name, and values that can't be
+// stored are reported as FieldErrors located in the file.
+func (p *Provider) bind(buf []byte, i interface{}, tree interface{}) error {
+	b := &walk.Binder{Tag: "yaml", Naming: p.naming, Loose: true, Custom: custom}
+	if p.resolver != nil {
+		b.Resolve = p.resolver.Resolve
 	}
 
-	return nil
+	var result errs.Errors
+	for _, e := range b.Bind(reflect.ValueOf(i), tree) {
+		key := strings.Join(e.Keys, ".")
+		fe := &errs.FileError{Path: p.path, Format: "yaml", Key: key, Err: e.Err}
+		if span, ok := locate.YAML(buf, e.Keys); ok {
+			fe.Line, _ = errs.Position(buf, int64(span.Start))
+			fe.Column, _ = keyAt(buf, fe.Line)
+		}
+		result = append(result, &errs.FieldError{Path: e.Path, Source: "yaml", Key: key, Value: e.Value, Err: fe})
+	}
+	return result.ErrorOrNil()
+}
+
+// custom hands values to types that decode YAML themselves.
+func custom(node, ptr interface{}) (bool, error) {
+	u, ok := ptr.(yaml.Unmarshaler)
+	if !ok {
+		return false, nil
+	}
+	buf, err := yaml.Marshal(node)
+	if err != nil {
+		return true, err
+	}
+	return true, yaml.Unmarshal(buf, u)
+}
+
+// keyAt finds the key defined on the given line and builds its
+// dotted path from the less indented keys above it.
+func keyAt(buf []byte, line int) (int, string) {
+	lines := strings.Split(string(buf), "\n")
+	if line < 1 || line > len(lines) {
+		return 0, ""
+	}
+
+	key, indent := splitKey(lines[line-1])
+	if key == "" {
+		return 0, ""
+	}
+	column := indent + 1
+
+	path := []string{key}
+	for i := line - 2; i >= 0 && indent > 0; i-- {
+		k, in := splitKey(lines[i])
+		if k != "" && in < indent {
+			path = append([]string{k}, path...)
+			indent = in
+		}
+	}
+	return column, strings.Join(path, ".")
+}
+
+func splitKey(line string) (string, int) {
+	trimmed := strings.TrimLeft(line, " ")
+	indent := len(line) - len(trimmed)
+	if strings.HasPrefix(trimmed, "- ") {
+		trimmed = trimmed[2:]
+		indent += 2
+	}
+	if strings.HasPrefix(trimmed, "#") {
+		return "", indent
+	}
+	idx := strings.Index(trimmed, ":")
+	if idx <= 0 {
+		return "", indent
+	}
+	return strings.Trim(trimmed[:idx], `"' `), indent
 }
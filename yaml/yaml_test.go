@@ -1,9 +1,14 @@
 package yaml
 
 import (
+	"errors"
+	"os"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/ande980/config/crypt"
+	"github.com/ande980/config/internal/errs"
 )
 
 type Config struct {
@@ -72,3 +77,112 @@ func TestNoFile(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestFileError(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		line int
+		col  int
+		key  string
+		path string
+	}{
+		{
+			"syntax", "abcd: x\nserver:\n  addr: 1\n addr: 2\n", 3, 3, "server.addr", "",
+		},
+		{
+			"type", "abcd: x\nserver:\n  addr: [1, 2]\n", 3, 3, "server.addr", "Server.Addr",
+		},
+	}
+
+	for _, test := range tests {
+		err := WithReader(strings.NewReader(test.in)).Parse(&Config{})
+		var fe *errs.FileError
+		if !errors.As(err, &fe) {
+			t.Errorf("%s: expected *errs.FileError, got %T", test.name, err)
+			continue
+		}
+
+		var fieldErr *errs.FieldError
+		if errors.As(err, &fieldErr) != (test.path != "") || (fieldErr != nil && fieldErr.Path != test.path) {
+			t.Errorf("%s: expected field '%s', got %v", test.name, test.path, fieldErr)
+		}
+
+		if fe.Format != "yaml" || fe.Line != test.line || fe.Column != test.col || fe.Key != test.key {
+			t.Errorf("%s: expected yaml %d:%d '%s', got %s %d:%d '%s'", test.name, test.line, test.col, test.key, fe.Format, fe.Line, fe.Column, fe.Key)
+		}
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("EXPAND_ADDR", ":9090")
+	defer os.Unsetenv("EXPAND_ADDR")
+
+	cfg := &Config{Server: &Server{}}
+	r := strings.NewReader("abcd: ${EXPAND_A:-default}\nserver:\n  addr: \"${EXPAND_ADDR}\"\n")
+	if err := WithReader(r).ExpandEnv(false).Parse(cfg); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if cfg.A != "default" {
+		t.Errorf("expected '%s', got '%s'", "default", cfg.A)
+	}
+
+	if cfg.Server.Addr != ":9090" {
+		t.Errorf("expected '%s', got '%s'", ":9090", cfg.Server.Addr)
+	}
+
+	r = strings.NewReader("abcd: $${EXPAND_A}\nserver:\n  addr: ${EXPAND_UNDEFINED}\n")
+	err := WithReader(r).ExpandEnv(true).Parse(cfg)
+
+	var fe *errs.FileError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected *errs.FileError, got '%v'", err)
+	}
+
+	if fe.Line != 3 || fe.Column != 9 {
+		t.Errorf("expected 3:9, got %d:%d", fe.Line, fe.Column)
+	}
+
+	// Errors are located in the file as written, not as expanded.
+	os.Setenv("EXPAND_TEXT", "one\ntwo\nthree")
+	defer os.Unsetenv("EXPAND_TEXT")
+	r = strings.NewReader("abcd: \"${EXPAND_TEXT}\"\nb: maybe\n")
+	err = WithReader(r).ExpandEnv(false).Parse(&Config{})
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected *errs.FileError, got '%v'", err)
+	}
+
+	if fe.Line != 2 || fe.Column != 1 {
+		t.Errorf("expected 2:1, got %d:%d", fe.Line, fe.Column)
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	key, err := crypt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := crypt.NewAESGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := a.Encrypt([]byte(":9090"), "str")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{Server: &Server{}}
+	r := strings.NewReader("abcd: x\nserver:\n  addr: " + v.String() + "\n")
+	if err := WithReader(r).WithDecrypter(a).Parse(cfg); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if cfg.Server.Addr != ":9090" {
+		t.Errorf("expected '%s', got '%s'", ":9090", cfg.Server.Addr)
+	}
+}